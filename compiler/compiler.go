@@ -0,0 +1,1003 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey-language/ast"
+	"monkey-language/code"
+	"monkey-language/object"
+	"monkey-language/token"
+)
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	sourceMap           map[int]token.Position
+	loops               []*loop     // the loops enclosing the current statement
+	tries               []*tryBlock // the tries enclosing the current statement
+	operands            int         // the values waiting on the stack for the expression being compiled
+}
+
+// loop tracks where break and continue jump to in the loop being compiled.
+// The breaks are patched once the end of the loop is known.
+type loop struct {
+	continuePos int
+	breaks      []int
+	tries       int // how many tries enclose the loop
+	operands    int // how many values wait on the stack when the loop starts
+}
+
+// tryBlock is a try enclosing the statement being compiled. Jumping out of
+// it with break, continue or return has to end its handler, if it still has
+// one, and run its finally block first.
+type tryBlock struct {
+	handler bool
+	finally *ast.BlockStatement
+}
+
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// err is the first operand that did not fit in its instruction, which
+	// Compile reports once it is done.
+	err error
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	SourceMap    map[int]token.Position
+	// GlobalNames holds the name of every global slot, so the VM can report
+	// globals that are read before they are defined.
+	GlobalNames []string
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions: code.Instructions{},
+		sourceMap:    map[int]token.Position{},
+	}
+
+	symbolTable := NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// NewWithState returns a compiler that keeps adding to the symbol table and
+// constants of an earlier compilation, as the REPL does between lines.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		err := c.Compile(node.Expression)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		// The value is compiled first, so that in let x = x + 1 the x on
+		// the right is the one the let shadows. A function is defined
+		// after its name instead, as its body only runs once the let is
+		// done, when its name is the variable defined here.
+		fn, isFunction := node.Value.(*ast.FunctionalLiteral)
+		isFunction = isFunction && fn.Name == node.Name.Value
+
+		var symbol Symbol
+		var err error
+		if isFunction {
+			symbol, err = c.defineVariable(node.Name, node.IsConst())
+			if err != nil {
+				return err
+			}
+		}
+
+		err = c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		if !isFunction {
+			symbol, err = c.defineVariable(node.Name, node.IsConst())
+			if err != nil {
+				return err
+			}
+		}
+
+		c.storeSymbol(symbol)
+
+	case *ast.WhileStatement:
+		startPos := len(c.currentInstructions())
+
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		exitPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		err = c.compileLoopBody(node.Body, startPos, exitPos)
+		if err != nil {
+			return err
+		}
+
+	case *ast.ForStatement:
+		err := c.Compile(node.Iterable)
+		if err != nil {
+			return err
+		}
+		c.emitAt(node.Iterable, code.OpIter)
+
+		// The iterator lives in a slot no identifier can name, one per
+		// level of nesting.
+		iterator := c.symbolTable.Define(fmt.Sprintf("for#%d", len(c.scopes[c.scopeIndex].loops)))
+		c.storeSymbol(iterator)
+
+		startPos := len(c.currentInstructions())
+		c.fetchSymbol(iterator)
+		exitPos := c.emit(code.OpIterNext, 9999)
+		variable, err := c.defineVariable(node.Variable, false)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(variable)
+
+		err = c.compileLoopBody(node.Body, startPos, exitPos)
+		if err != nil {
+			return err
+		}
+
+	case *ast.BreakStatement:
+		l, err := c.currentLoop(node)
+		if err != nil {
+			return err
+		}
+		err = c.leaveLoopBody(l)
+		if err != nil {
+			return err
+		}
+		l.breaks = append(l.breaks, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		l, err := c.currentLoop(node)
+		if err != nil {
+			return err
+		}
+		err = c.leaveLoopBody(l)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, l.continuePos)
+
+	case *ast.ReturnStatement:
+		err := c.Compile(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+
+		err = c.leaveTries(0)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpReturnValue)
+
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		c.emitAt(node, code.OpThrow)
+
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+
+	case *ast.PrefixExpression:
+		err := c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emitAt(node, code.OpBang)
+		case "-":
+			c.emitAt(node, code.OpMinus)
+		case "~":
+			c.emitAt(node, code.OpBitNot)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+
+		err := c.compileOperands(node.Left, node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "+":
+			c.emitAt(node, code.OpAdd)
+		case "-":
+			c.emitAt(node, code.OpSub)
+		case "*":
+			c.emitAt(node, code.OpMul)
+		case "/":
+			c.emitAt(node, code.OpDiv)
+		case "%":
+			c.emitAt(node, code.OpMod)
+		case "&":
+			c.emitAt(node, code.OpBitAnd)
+		case "|":
+			c.emitAt(node, code.OpBitOr)
+		case "^":
+			c.emitAt(node, code.OpBitXor)
+		case "<<":
+			c.emitAt(node, code.OpShiftLeft)
+		case ">>":
+			c.emitAt(node, code.OpShiftRight)
+		case ">":
+			c.emitAt(node, code.OpGreaterThan)
+		case "<":
+			c.emitAt(node, code.OpLessThan)
+		case ">=":
+			c.emitAt(node, code.OpGreaterEqual)
+		case "<=":
+			c.emitAt(node, code.OpLessEqual)
+		case "==":
+			c.emitAt(node, code.OpEqual)
+		case "!=":
+			c.emitAt(node, code.OpNotEqual)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.IntegerLiteral:
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = &object.BigInteger{Value: node.Big}
+		}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.IfExpression:
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		// Emit an `OpJumpNotTruthy` with a bogus value
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		err = c.compileBlockValue(node.Consequence)
+		if err != nil {
+			return err
+		}
+
+		// Emit an `OpJump` with a bogus value
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		afterConsequencePos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else {
+			err := c.compileBlockValue(node.Alternative)
+			if err != nil {
+				return err
+			}
+		}
+
+		afterAlternativePos := len(c.currentInstructions())
+		c.changeOperand(jumpPos, afterAlternativePos)
+
+	case *ast.Identifier:
+		c.loadSymbol(node)
+
+	case *ast.ArrayLiteral:
+		elements := make([]ast.Node, len(node.Elements))
+		for i, el := range node.Elements {
+			elements[i] = el
+		}
+
+		err := c.compileOperands(elements...)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+
+	case *ast.HashLiteral:
+		for i, pair := range node.Pairs {
+			err := c.withOperands(2*i, func() error {
+				return c.compileHashKey(pair.Key)
+			})
+			if err != nil {
+				return err
+			}
+
+			err = c.withOperands(2*i+1, func() error {
+				return c.Compile(pair.Value)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emitAt(node, code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		err := c.compileOperands(node.Left, node.Index)
+		if err != nil {
+			return err
+		}
+
+		c.emitAt(node, code.OpIndex)
+
+	case *ast.MemberExpression:
+		err := c.Compile(node.Object)
+		if err != nil {
+			return err
+		}
+
+		name := &object.String{Value: node.Member.Value}
+		c.emitAt(node, code.OpMember, c.addConstant(name))
+
+	case *ast.FunctionalLiteral:
+		c.enterScope()
+
+		for _, p := range node.Parameters {
+			c.symbolTable.Define(p.Value)
+		}
+
+		err := c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+
+		if c.lastInstructionIs(code.OpPop) {
+			c.replaceLastPopWithReturn()
+		}
+		if !c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(code.OpReturn)
+		}
+
+		freeSymbols := c.symbolTable.FreeSymbols
+		numLocals := c.symbolTable.numDefinitions
+		sourceMap := c.scopes[c.scopeIndex].sourceMap
+		instructions := c.leaveScope()
+
+		for _, s := range freeSymbols {
+			c.captureSymbol(s)
+		}
+
+		compiledFn := &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     numLocals,
+			NumParameters: len(node.Parameters),
+			Name:          node.Name,
+			SourceMap:     sourceMap,
+		}
+
+		fnIndex := c.addConstant(compiledFn)
+		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+
+	case *ast.CallExpression:
+		operands := []ast.Node{node.Function}
+		for _, a := range node.Arguments {
+			operands = append(operands, a)
+		}
+
+		err := c.compileOperands(operands...)
+		if err != nil {
+			return err
+		}
+
+		c.emitAt(node, code.OpCall, len(node.Arguments))
+
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+
+	return c.err
+}
+
+// compoundOperators maps compound assignment operators to the opcode that
+// combines the current value with the assigned one.
+var compoundOperators = map[string]code.Opcode{
+	"+=": code.OpAdd,
+	"-=": code.OpSub,
+	"*=": code.OpMul,
+	"/=": code.OpDiv,
+	"%=": code.OpMod,
+}
+
+// compileAssignExpression leaves the assigned value on the stack.
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	op, compound := compoundOperators[node.Operator]
+	if !compound && node.Operator != "=" {
+		return fmt.Errorf("unknown operator %s", node.Operator)
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(target.Value)
+		if !ok {
+			symbol = c.symbolTable.Global().Define(target.Value)
+		}
+
+		origin := c.symbolTable.origin(symbol)
+		switch {
+		case origin.Scope == BuiltinScope:
+			return fmt.Errorf("%s: cannot assign to undefined identifier: %s", node.Pos(), target.Value)
+		case origin.Constant:
+			return fmt.Errorf("%s: cannot assign to constant: %s", node.Pos(), target.Value)
+		}
+
+		operands := 0
+		if compound {
+			c.loadSymbol(target)
+			operands = 1
+		}
+
+		err := c.withOperands(operands, func() error {
+			return c.Compile(node.Value)
+		})
+		if err != nil {
+			return err
+		}
+
+		if compound {
+			c.emitAt(node, op)
+		}
+
+		switch symbol.Scope {
+		case GlobalScope:
+			c.emitAt(node, code.OpAssignGlobal, symbol.Index)
+		case LocalScope:
+			c.emit(code.OpSetLocal, symbol.Index)
+			c.emit(code.OpGetLocal, symbol.Index)
+		case FreeScope:
+			c.emit(code.OpSetFree, symbol.Index)
+			c.emit(code.OpGetFree, symbol.Index)
+		}
+
+	case *ast.IndexExpression:
+		err := c.compileOperands(target.Left, target.Index)
+		if err != nil {
+			return err
+		}
+
+		operands := 2
+		if compound {
+			c.emit(code.OpDup2)
+			c.emitAt(target, code.OpIndex)
+			operands = 3
+		}
+
+		err = c.withOperands(operands, func() error {
+			return c.Compile(node.Value)
+		})
+		if err != nil {
+			return err
+		}
+
+		if compound {
+			c.emitAt(node, op)
+		}
+
+		c.emitAt(node, code.OpSetIndex)
+
+	default:
+		return fmt.Errorf("%s: cannot assign to %s", node.Pos(), node.Target.String())
+	}
+
+	return nil
+}
+
+// compileHashKey compiles the key of a pair of a hash literal, checked
+// before the value is evaluated unless it is a literal that is always a
+// usable key.
+func (c *Compiler) compileHashKey(key ast.Expression) error {
+	err := c.Compile(key)
+	if err != nil {
+		return err
+	}
+
+	switch key.(type) {
+	case *ast.StringLiteral, *ast.IntegerLiteral, *ast.Boolean:
+	default:
+		c.emitAt(key, code.OpHashKey)
+	}
+	return nil
+}
+
+// compileLogicalExpression compiles && and || so the right operand is only
+// evaluated when the left one does not decide the result. Either way the
+// result is a boolean: the decided value, or the right operand passed
+// through OpBang twice.
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	// For || the left operand is negated, so the jump is taken when it is
+	// truthy.
+	if node.Operator == "||" {
+		c.emit(code.OpBang)
+	}
+	jumpPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+	endJumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	if node.Operator == "||" {
+		c.emit(code.OpTrue)
+	} else {
+		c.emit(code.OpFalse)
+	}
+
+	c.changeOperand(endJumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileBlockValue compiles a block used as an expression, leaving the
+// value of its last expression statement, or null, on the stack.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+// compileLoopBody compiles the body of a loop that starts at startPos,
+// followed by the jump back to the start. The jump at exitPos and any break
+// in the body are patched to leave the loop.
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement, startPos, exitPos int) error {
+	scope := c.scopes[c.scopeIndex]
+	l := &loop{continuePos: startPos, tries: len(scope.tries), operands: scope.operands}
+	c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, l)
+
+	err := c.Compile(body)
+	if err != nil {
+		return err
+	}
+
+	loops := c.scopes[c.scopeIndex].loops
+	c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+
+	c.emit(code.OpJump, startPos)
+
+	afterLoopPos := len(c.currentInstructions())
+	c.changeOperand(exitPos, afterLoopPos)
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, afterLoopPos)
+	}
+
+	return nil
+}
+
+// compileTryExpression leaves the value of the try or catch block on the
+// stack. A finally block is compiled as a try around the try and catch
+// blocks. It runs after them and, when they raise an error, before the error
+// is raised again.
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	if node.Finally == nil {
+		return c.compileTryCatch(node)
+	}
+
+	tryPos := c.emit(code.OpTry, 9999)
+
+	err := c.withTry(&tryBlock{handler: true, finally: node.Finally}, func() error {
+		if node.Catch == nil {
+			return c.compileBlockValue(node.Block)
+		}
+		return c.compileTryCatch(node)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpEndTry)
+	err = c.withOperands(1, func() error {
+		return c.Compile(node.Finally)
+	})
+	if err != nil {
+		return err
+	}
+	endPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+
+	// The error is kept in a slot no identifier can name, one per level of
+	// nesting, while the finally block runs.
+	saved := c.symbolTable.Define(fmt.Sprintf("try#%d", len(c.scopes[c.scopeIndex].tries)))
+	c.storeSymbol(saved)
+
+	err = c.withTry(&tryBlock{}, func() error {
+		return c.Compile(node.Finally)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.fetchSymbol(saved)
+	c.emit(code.OpThrow)
+
+	c.changeOperand(endPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+func (c *Compiler) compileTryCatch(node *ast.TryExpression) error {
+	tryPos := c.emit(code.OpTry, 9999)
+
+	err := c.withTry(&tryBlock{handler: true}, func() error {
+		return c.compileBlockValue(node.Block)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpEndTry)
+	endPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+	c.emit(code.OpCatch)
+
+	param, err := c.defineVariable(node.CatchParam, false)
+	if err != nil {
+		return err
+	}
+	c.storeSymbol(param)
+
+	err = c.compileBlockValue(node.Catch)
+	if err != nil {
+		return err
+	}
+
+	c.changeOperand(endPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// withTry compiles the code inside t.
+func (c *Compiler) withTry(t *tryBlock, compile func() error) error {
+	c.scopes[c.scopeIndex].tries = append(c.scopes[c.scopeIndex].tries, t)
+	err := compile()
+
+	tries := c.scopes[c.scopeIndex].tries
+	c.scopes[c.scopeIndex].tries = tries[:len(tries)-1]
+
+	return err
+}
+
+// leaveTries emits what jumping out of the tries beyond the first n of the
+// current scope takes, innermost first: ending their handlers and running
+// their finally blocks, each outside of the try it belongs to.
+func (c *Compiler) leaveTries(n int) error {
+	tries := c.scopes[c.scopeIndex].tries
+
+	for i := len(tries) - 1; i >= n; i-- {
+		if tries[i].handler {
+			c.emit(code.OpEndTry)
+		}
+
+		if tries[i].finally != nil {
+			c.scopes[c.scopeIndex].tries = tries[:i]
+			err := c.Compile(tries[i].finally)
+			c.scopes[c.scopeIndex].tries = tries
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// leaveLoopBody emits what jumping out of the body of l with break or
+// continue takes: dropping the values that the expressions around the jump
+// left on the stack and leaving the tries inside the loop.
+func (c *Compiler) leaveLoopBody(l *loop) error {
+	for i := c.scopes[c.scopeIndex].operands; i > l.operands; i-- {
+		c.emit(code.OpPop)
+	}
+	return c.leaveTries(l.tries)
+}
+
+// compileOperands compiles nodes in order, each while the values of the
+// ones before it wait on the stack.
+func (c *Compiler) compileOperands(nodes ...ast.Node) error {
+	for i, node := range nodes {
+		err := c.withOperands(i, func() error {
+			return c.Compile(node)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withOperands compiles the code that runs while n more values wait on the
+// stack for the expression being compiled.
+func (c *Compiler) withOperands(n int, compile func() error) error {
+	c.scopes[c.scopeIndex].operands += n
+	err := compile()
+	c.scopes[c.scopeIndex].operands -= n
+	return err
+}
+
+func (c *Compiler) currentLoop(node ast.Node) (*loop, error) {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil, fmt.Errorf("%s: %s outside of a loop", node.Pos(), node.TokenLiteral())
+	}
+	return loops[len(loops)-1], nil
+}
+
+// defineVariable defines name in the current scope, where it must not
+// already be a constant.
+func (c *Compiler) defineVariable(name *ast.Identifier, constant bool) (Symbol, error) {
+	if c.symbolTable.isConstant(name.Value) {
+		return Symbol{}, fmt.Errorf("%s: cannot redeclare constant: %s", name.Pos(), name.Value)
+	}
+
+	if constant {
+		return c.symbolTable.DefineConstant(name.Value), nil
+	}
+	return c.symbolTable.Define(name.Value), nil
+}
+
+func (c *Compiler) storeSymbol(symbol Symbol) {
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+}
+
+// fetchSymbol pushes the value of a symbol defined in the current scope.
+func (c *Compiler) fetchSymbol(symbol Symbol) {
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpGetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpGetLocal, symbol.Index)
+	}
+}
+
+func (c *Compiler) loadSymbol(node *ast.Identifier) {
+	symbol, ok := c.symbolTable.Resolve(node.Value)
+	if !ok {
+		// The name may be a global that is defined further down the
+		// program, reserve its slot and let the VM check it at runtime.
+		symbol = c.symbolTable.Global().Define(node.Value)
+	}
+
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emitAt(node, code.OpGetGlobal, symbol.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, symbol.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, symbol.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, symbol.Index)
+	}
+}
+
+// captureSymbol pushes the cell holding a variable that a closure being
+// created captures from the current scope.
+func (c *Compiler) captureSymbol(symbol Symbol) {
+	switch symbol.Scope {
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, symbol.Index)
+	case FreeScope:
+		c.emit(code.OpCaptureFree, symbol.Index)
+	}
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
+		GlobalNames:  c.symbolTable.GlobalNames(),
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands...)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+// emitAt emits an instruction that can fail at runtime and records the
+// position of node for it, so the VM can report where the error occurred.
+func (c *Compiler) emitAt(node ast.Node, op code.Opcode, operands ...int) int {
+	pos := c.emit(op, operands...)
+	c.scopes[c.scopeIndex].sourceMap[pos] = node.Pos()
+	return pos
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
+
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	old := c.currentInstructions()
+	new := old[:last.Position]
+
+	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(op, operand)
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+// checkOperands records an error for operands that do not fit in op, such as
+// a jump too far or a local slot past the 256 a function can have.
+func (c *Compiler) checkOperands(op code.Opcode, operands ...int) {
+	if err := code.CheckOperands(op, operands...); err != nil && c.err == nil {
+		c.err = fmt.Errorf("program too large to compile: %s", err)
+	}
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions: code.Instructions{},
+		sourceMap:    map[int]token.Position{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
@@ -0,0 +1,137 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
+	FreeScope    SymbolScope = "FREE"
+)
+
+type Symbol struct {
+	Name     string
+	Scope    SymbolScope
+	Index    int
+	Constant bool
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	free := []Symbol{}
+	return &SymbolTable{store: s, FreeSymbols: free}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define binds name in the table's scope. Redefining a name in the same
+// scope reuses its slot, so globals referenced before their definition
+// resolve to it, and a let in a loop body updates the same variable on every
+// iteration.
+func (s *SymbolTable) Define(name string) Symbol {
+	scope := LocalScope
+	if s.Outer == nil {
+		scope = GlobalScope
+	}
+
+	if symbol, ok := s.store[name]; ok && symbol.Scope == scope {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Index: s.numDefinitions, Scope: scope}
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+// DefineConstant binds name like Define, marking it as a constant.
+func (s *SymbolTable) DefineConstant(name string) Symbol {
+	symbol := s.Define(name)
+	symbol.Constant = true
+	s.store[name] = symbol
+	return symbol
+}
+
+// isConstant reports whether name is a constant of the table's own scope.
+func (s *SymbolTable) isConstant(name string) bool {
+	symbol, ok := s.store[name]
+	return ok && symbol.Constant
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol.Scope = FreeScope
+
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		obj, ok = s.Outer.Resolve(name)
+		if !ok {
+			return obj, ok
+		}
+
+		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+			return obj, ok
+		}
+
+		free := s.defineFree(obj)
+		return free, true
+	}
+	return obj, ok
+}
+
+// origin returns the symbol that symbol, resolved in s, refers to in the
+// scope defining it.
+func (s *SymbolTable) origin(symbol Symbol) Symbol {
+	for symbol.Scope == FreeScope {
+		symbol = s.FreeSymbols[symbol.Index]
+		s = s.Outer
+	}
+	return symbol
+}
+
+// Global returns the outermost table, which holds the global scope.
+func (s *SymbolTable) Global() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+// GlobalNames returns the names of the globals indexed by their slot.
+func (s *SymbolTable) GlobalNames() []string {
+	global := s.Global()
+
+	names := make([]string, global.numDefinitions)
+	for name, symbol := range global.store {
+		if symbol.Scope == GlobalScope {
+			names[symbol.Index] = name
+		}
+	}
+	return names
+}
@@ -0,0 +1,73 @@
+package compiler
+
+import "testing"
+
+func TestResolveNestedScopes(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("b")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("c")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "b", Scope: FreeScope, Index: 0},
+		{Name: "c", Scope: LocalScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := secondLocal.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	if len(secondLocal.FreeSymbols) != 1 || secondLocal.FreeSymbols[0].Name != "b" {
+		t.Errorf("wrong free symbols, got=%+v", secondLocal.FreeSymbols)
+	}
+
+	if _, ok := secondLocal.Resolve("d"); ok {
+		t.Errorf("name d resolved, but was expected not to")
+	}
+}
+
+func TestDefineReusesGlobalSlot(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	b := global.Define("b")
+	again := global.Define("a")
+
+	if again != a {
+		t.Errorf("redefined global got new slot, want=%+v, got=%+v", a, again)
+	}
+
+	names := global.GlobalNames()
+	if len(names) != 2 || names[a.Index] != "a" || names[b.Index] != "b" {
+		t.Errorf("wrong global names, got=%v", names)
+	}
+}
+
+func TestDefineReusesLocalSlot(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	local := NewEnclosedSymbolTable(global)
+	b := local.Define("b")
+	a := local.Define("a")
+
+	if again := local.Define("b"); again != b {
+		t.Errorf("redefined local got new slot, want=%+v, got=%+v", b, again)
+	}
+
+	expected := Symbol{Name: "a", Scope: LocalScope, Index: 1}
+	if a != expected {
+		t.Errorf("local shadowing a global got wrong symbol, want=%+v, got=%+v", expected, a)
+	}
+}
@@ -0,0 +1,167 @@
+package diagnostic
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"monkey-language/token"
+	"strings"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Code identifies the kind of a diagnostic, so tools can match on it
+// without parsing the message.
+type Code string
+
+const (
+	IllegalCharacter    Code = "L001" // a character that starts no token
+	UnterminatedComment Code = "L002" // a block comment without "*/"
+	UnterminatedString  Code = "L003" // a string without its closing quote
+	InvalidEscape       Code = "L004" // an unknown or malformed escape sequence
+	InvalidExponent     Code = "L005" // a number whose exponent has no digits
+
+	UnexpectedToken    Code = "P001" // a specific token was expected
+	ExpectedExpression Code = "P002" // no expression can start with the token
+	InvalidNumber      Code = "P003" // a number literal could not be parsed
+	OutsideLoop        Code = "P004" // break or continue outside a loop
+	InvalidAssignment  Code = "P005" // the left side cannot be assigned to
+)
+
+// Span is the source range a diagnostic refers to. End is exclusive.
+type Span struct {
+	Start token.Position `json:"start"`
+	End   token.Position `json:"end"`
+}
+
+type Diagnostic struct {
+	Severity Severity          `json:"severity"`
+	Code     Code              `json:"code"`
+	Message  string            `json:"message"`
+	Span     Span              `json:"span"`
+	Expected []token.TokenType `json:"expected,omitempty"`
+	Actual   token.TokenType   `json:"actual,omitempty"`
+	Fix      string            `json:"fix,omitempty"` // suggested fix, if any
+}
+
+// New returns an error diagnostic covering tok.
+func New(code Code, tok token.Token, format string, a ...interface{}) *Diagnostic {
+	return &Diagnostic{
+		Severity: Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Span:     Span{Start: tok.Pos, End: tok.End},
+		Actual:   tok.Type,
+	}
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s", d.Span.Start, d.Message)
+}
+
+// Render writes the diagnostic followed by the offending line of source
+// with the span underlined, e.g.
+//
+//	main.mk:1:7: error[P001]: expected next token to be =, got INT instead
+//	 1 | let x 5;
+//	   |       ^
+//	   = help: insert "="
+func (d *Diagnostic) Render(w io.Writer, source string) {
+	var out bytes.Buffer
+
+	fmt.Fprintf(&out, "%s: %s[%s]: %s\n", d.Span.Start, d.Severity, d.Code, d.Message)
+
+	line, ok := sourceLine(source, d.Span.Start)
+	if ok {
+		gutter := fmt.Sprintf(" %d ", d.Span.Start.Line)
+		blank := strings.Repeat(" ", len(gutter))
+
+		fmt.Fprintf(&out, "%s| %s\n", gutter, line)
+		fmt.Fprintf(&out, "%s| %s\n", blank, underline(line, d.Span))
+
+		if d.Fix != "" {
+			fmt.Fprintf(&out, "%s= help: %s\n", blank, d.Fix)
+		}
+	} else if d.Fix != "" {
+		fmt.Fprintf(&out, "   = help: %s\n", d.Fix)
+	}
+
+	w.Write(out.Bytes())
+}
+
+// RenderAll renders each diagnostic in turn.
+func RenderAll(w io.Writer, source string, diagnostics []*Diagnostic) {
+	for _, d := range diagnostics {
+		d.Render(w, source)
+	}
+}
+
+func sourceLine(source string, pos token.Position) (string, bool) {
+	if !pos.IsValid() {
+		return "", false
+	}
+
+	lines := strings.Split(source, "\n")
+	if pos.Line > len(lines) {
+		return "", false
+	}
+
+	return strings.TrimRight(lines[pos.Line-1], "\r"), true
+}
+
+// underline builds the caret line for span. Columns count chars, not bytes.
+// Tabs before the span are kept so the carets line up with the source however
+// wide the terminal renders them.
+func underline(line string, span Span) string {
+	chars := []rune(line)
+
+	start := span.Start.Column - 1
+	if start > len(chars) {
+		start = len(chars)
+	}
+
+	end := len(chars)
+	if span.End.Line == span.Start.Line {
+		end = span.End.Column - 1
+		if end > len(chars) {
+			end = len(chars)
+		}
+	}
+
+	var out strings.Builder
+	for i := 0; i < start; i++ {
+		if chars[i] == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+
+	width := end - start
+	if width < 1 {
+		width = 1
+	}
+	out.WriteString(strings.Repeat("^", width))
+
+	return out.String()
+}
@@ -0,0 +1,74 @@
+package diagnostic
+
+import (
+	"bytes"
+	"monkey-language/token"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	source := "let a = 1;\n\tlet b c;"
+
+	d := &Diagnostic{
+		Severity: Error,
+		Code:     UnexpectedToken,
+		Message:  "expected next token to be =, got IDENT instead",
+		Span: Span{
+			Start: token.Position{Filename: "main.mk", Offset: 18, Line: 2, Column: 8},
+			End:   token.Position{Filename: "main.mk", Offset: 19, Line: 2, Column: 9},
+		},
+		Fix: `insert "="`,
+	}
+
+	expected := "main.mk:2:8: error[P001]: expected next token to be =, got IDENT instead\n" +
+		" 2 | \tlet b c;\n" +
+		"   | \t      ^\n" +
+		"   = help: insert \"=\"\n"
+
+	var out bytes.Buffer
+	d.Render(&out, source)
+
+	if out.String() != expected {
+		t.Errorf("wrong rendering, expected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestRenderUnderlinesWholeToken(t *testing.T) {
+	d := New(ExpectedExpression, token.Token{
+		Type:    token.IDENT,
+		Literal: "foobar",
+		Pos:     token.Position{Line: 1, Column: 5},
+		End:     token.Position{Line: 1, Column: 11},
+	}, "unexpected %s", "foobar")
+
+	expected := "1:5: error[P002]: unexpected foobar\n" +
+		" 1 | let foobar\n" +
+		"   |     ^^^^^^\n"
+
+	var out bytes.Buffer
+	d.Render(&out, "let foobar")
+
+	if out.String() != expected {
+		t.Errorf("wrong rendering, expected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestRenderCountsColumnsInChars(t *testing.T) {
+	d := New(IllegalCharacter, token.Token{
+		Type:    token.ILLEGAL,
+		Literal: "≠",
+		Pos:     token.Position{Line: 1, Column: 8},
+		End:     token.Position{Line: 1, Column: 9},
+	}, "illegal character %q", "≠")
+
+	expected := "1:8: error[L001]: illegal character \"≠\"\n" +
+		" 1 | \"héé\" ≠ 1\n" +
+		"   |        ^\n"
+
+	var out bytes.Buffer
+	d.Render(&out, "\"héé\" ≠ 1")
+
+	if out.String() != expected {
+		t.Errorf("wrong rendering, expected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
@@ -2,124 +2,254 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"monkey-language/ast"
 	"monkey-language/object"
+	"monkey-language/token"
+	"strings"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL     = object.NULL
+	TRUE     = object.TRUE
+	FALSE    = object.FALSE
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
+func (s *state) eval(node ast.Node, env *object.Environment) object.Object {
+	if err := s.step(); err != nil {
+		return withPosition(err, node)
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node.Statements, env)
+		return s.evalProgram(node.Statements, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return s.eval(node.Expression, env)
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return s.alloc.NewBigInteger(node.Big)
+		}
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBoolToBoolObject(node.Value)
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := s.eval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return withPosition(s.evalPrefixExpression(node.Operator, right), node)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		if node.Operator == "&&" || node.Operator == "||" {
+			return s.evalLogicalExpression(node, env)
+		}
+		left := s.eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := s.eval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return withPosition(s.evalInfixExpression(node.Operator, left, right), node)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return s.evalBlockStatement(node, env)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return s.evalIfExpression(node, env)
+	case *ast.WhileStatement:
+		return s.evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return s.evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
+	case *ast.ThrowStatement:
+		val := s.eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		return withPosition(object.Throw(val), node)
+	case *ast.TryExpression:
+		return s.evalTryExpression(node, env)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		val := s.eval(node.ReturnValue, env)
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
+		val := s.eval(node.Value, env)
+		if isAbrupt(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if !env.Declare(node.Name.Value, val, node.IsConst(), node) {
+			return withPosition(newError("cannot redeclare constant: %s", node.Name.Value), node.Name)
+		}
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return withPosition(evalIdentifier(node, env), node)
 	case *ast.FunctionalLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{Name: node.Name, Parameters: params, Body: body, Env: env}
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
+		function := s.eval(node.Function, env)
+		if isAbrupt(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		args := s.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		return withPosition(s.applyFunction(function, args, node.Pos()), node)
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		return s.alloc.NewString(node.Value)
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		elements := s.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return s.alloc.NewArray(elements)
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		left := s.eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
-		if isError(index) {
+		index := s.eval(node.Index, env)
+		if isAbrupt(index) {
 			return index
 		}
 
-		return evalIndexExpression(left, index)
+		return withPosition(evalIndexExpression(left, index), node)
+	case *ast.MemberExpression:
+		obj := s.eval(node.Object, env)
+		if isAbrupt(obj) {
+			return obj
+		}
+		return withPosition(object.Member(obj, node.Member.Value), node)
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return withPosition(s.evalHashLiteral(node, env), node)
+	case *ast.AssignExpression:
+		return withPosition(s.evalAssignExpression(node, env), node)
 	}
 	return nil
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+func (s *state) evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		if env.IsConst(target.Value) {
+			return newError("cannot assign to constant: %s", target.Value)
+		}
 
-	for keyNode, keyValue := range node.Paris {
-		key := Eval(keyNode, env)
-		if isError(key) {
-			return key
+		var current object.Object
+		if node.Operator != "=" {
+			current = withPosition(evalIdentifier(target, env), target)
+			if isAbrupt(current) {
+				return current
+			}
+		}
+
+		val := s.evalAssignedValue(node, current, env)
+		if isAbrupt(val) {
+			return val
+		}
+
+		if !env.Assign(target.Value, val) {
+			return newError("cannot assign to undefined identifier: %s", target.Value)
 		}
+		return val
 
-		hashKey, ok := key.(object.Hashable)
+	case *ast.IndexExpression:
+		left := s.eval(target.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		index := s.eval(target.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+
+		var current object.Object
+		if node.Operator != "=" {
+			current = withPosition(evalIndexExpression(left, index), target)
+			if isAbrupt(current) {
+				return current
+			}
+		}
+
+		val := s.evalAssignedValue(node, current, env)
+		if isAbrupt(val) {
+			return val
+		}
+
+		return s.evalIndexAssignment(left, index, val)
+
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+}
+
+// evalAssignedValue evaluates the right side of an assignment and, for a
+// compound assignment such as +=, combines it with the current value.
+func (s *state) evalAssignedValue(node *ast.AssignExpression, current object.Object, env *object.Environment) object.Object {
+	val := s.eval(node.Value, env)
+	if isAbrupt(val) || node.Operator == "=" {
+		return val
+	}
+
+	operator := strings.TrimSuffix(node.Operator, "=")
+	return s.evalInfixExpression(operator, current, val)
+}
+
+func (s *state) evalIndexAssignment(left, index, val object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		idx, ok := index.(*object.Integer)
+		if !ok || idx.Value < 0 || idx.Value >= int64(len(elements)) {
+			return newError("index out of range: %s", index.Inspect())
+		}
+		elements[idx.Value] = val
+		return val
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
 		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		return s.alloc.SetPair(left.(*object.Hash), key.HashKey(), object.HashPair{Key: index, Value: val})
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+}
+
+func (s *state) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	pairs := make([]object.HashPair, 0, len(node.Pairs))
+
+	for _, pair := range node.Pairs {
+		key := s.eval(pair.Key, env)
+		if isAbrupt(key) {
+			return key
 		}
 
-		value := Eval(keyValue, env)
-		if isError(value) {
+		if _, ok := key.(object.Hashable); !ok {
+			return withPosition(newError("unusable as hash key: %s", key.Type()), pair.Key)
+		}
+
+		value := s.eval(pair.Value, env)
+		if isAbrupt(value) {
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		pairs = append(pairs, object.HashPair{Key: key, Value: value})
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return s.alloc.NewHash(pairs)
 }
 
 func evalIndexExpression(left, index object.Object) object.Object {
@@ -143,7 +273,7 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 		return newError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	pair, ok := hashObject.Get(key.HashKey())
 	if !ok {
 		return NULL
 	}
@@ -151,38 +281,73 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	return pair.Value
 }
 
+// evalStringIndexExpression indexes a string by chars, not bytes.
 func evalStringIndexExpression(str, index object.Object) object.Object {
 	stringObject := str.(*object.String)
-	idx := index.(*object.Integer).Value
-	max := int64(len(stringObject.Value) - 1)
-
-	if idx < 0 || idx > max {
+	integer, ok := index.(*object.Integer)
+	if !ok || integer.Value < 0 {
 		return NULL
 	}
 
-	return &object.Byte{Value: stringObject.Value[idx]}
+	idx := integer.Value
+
+	for _, ch := range stringObject.Value {
+		if idx == 0 {
+			return &object.Char{Value: ch}
+		}
+		idx--
+	}
+
+	return NULL
 }
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
+	idx, ok := index.(*object.Integer)
 	max := int64(len(arrayObject.Elements) - 1)
 
-	if idx < 0 || idx > max {
+	// A big integer is out of the range of any array.
+	if !ok || idx.Value < 0 || idx.Value > max {
 		return NULL
 	}
 
-	return arrayObject.Elements[idx]
+	return arrayObject.Elements[idx.Value]
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// applyFunction calls fn from pos, adding the call to the stack of any error
+// raised in the body of fn.
+func (s *state) applyFunction(fn object.Object, args []object.Object, pos token.Position) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		}
+		if s.depth >= s.maxDepth {
+			return &object.Error{
+				Kind:    object.STACK_OVERFLOW_ERR,
+				Message: fmt.Sprintf("stack overflow: maximum call depth of %d exceeded", s.maxDepth),
+			}
+		}
+
+		s.depth++
 		expectedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, expectedEnv)
+		evaluated := s.eval(fn.Body, expectedEnv)
+		s.depth--
+
+		if errObj, ok := evaluated.(*object.Error); ok {
+			errObj.Stack = append(errObj.Stack, object.Frame{Function: fn.Name, Pos: pos})
+		}
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		return fn.Fn(args...)
+		outer := s.builtinPos
+		s.builtinPos = pos
+		result := fn.Fn(s, args...)
+		s.builtinPos = outer
+
+		if result != nil {
+			return result
+		}
+		return NULL
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
@@ -206,12 +371,12 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func (s *state) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var results []object.Object
 
 	for _, e := range exps {
-		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		evaluated := s.eval(e, env)
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		results = append(results, evaluated)
@@ -232,21 +397,108 @@ func evalIdentifier(ie *ast.Identifier, env *object.Environment) object.Object {
 	return newError("identifier not found: " + ie.Value)
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
-	if isError(condition) {
+func (s *state) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := s.eval(ie.Condition, env)
+	if isAbrupt(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return s.eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return s.eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
 }
 
+func (s *state) evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := s.eval(ws.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		result := s.eval(ws.Body, env)
+		if result == BREAK {
+			return nil
+		}
+		if isReturnOrError(result) {
+			return result
+		}
+	}
+}
+
+// evalForStatement runs the body once per value of the iterable. Like the
+// body of an if, it runs in the enclosing environment, which also holds the
+// loop variable.
+func (s *state) evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := s.eval(fs.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+
+	values, ok := object.Iterate(iterable)
+	if !ok {
+		return withPosition(newError("cannot iterate over %s", iterable.Type()), fs.Iterable)
+	}
+
+	for _, value := range values {
+		if !env.Declare(fs.Variable.Value, value, false, fs) {
+			return withPosition(newError("cannot redeclare constant: %s", fs.Variable.Value), fs.Variable)
+		}
+
+		result := s.eval(fs.Body, env)
+		if result == BREAK {
+			return nil
+		}
+		if isReturnOrError(result) {
+			return result
+		}
+	}
+
+	return nil
+}
+
+// evalTryExpression evaluates to the value of the try block or, if it raises
+// an error, of the catch block. Like the body of a loop, the catch block runs
+// in the enclosing environment, which also holds the caught error. Fatal
+// errors, such as a timeout, are neither caught nor run the finally block.
+func (s *state) evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := s.eval(te.Block, env)
+
+	if errObj, ok := result.(*object.Error); ok && te.Catch != nil && !errObj.Kind.Fatal() {
+		if !env.Declare(te.CatchParam.Value, errObj.Caught(), false, te) {
+			return withPosition(newError("cannot redeclare constant: %s", te.CatchParam.Value), te.CatchParam)
+		}
+		result = s.eval(te.Catch, env)
+	}
+
+	if errObj, ok := result.(*object.Error); ok && errObj.Kind.Fatal() {
+		return result
+	}
+
+	if te.Finally != nil {
+		finally := s.eval(te.Finally, env)
+		if isAbrupt(finally) {
+			return finally
+		}
+	}
+
+	return result
+}
+
+func isReturnOrError(obj object.Object) bool {
+	if obj == nil {
+		return false
+	}
+	return obj.Type() == object.RETURN_VALUE_OBJ || obj.Type() == object.ERROR_OBJ
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -260,11 +512,11 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
-func evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
+func (s *state) evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range stmts {
-		result = Eval(statement, env)
+		result = s.eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
@@ -277,33 +529,62 @@ func evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
 	return result
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
-	var result object.Object
+// evalBlockStatement returns the value of the last statement in the block,
+// or NULL if it has none, as when the block ends with a let or a loop.
+func (s *state) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object = NULL
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = s.eval(statement, env)
 
-		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
-				return result
-			}
+		if result == nil {
+			result = NULL
+			continue
+		}
+
+		switch result.Type() {
+		case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+			return result
 		}
 	}
 
 	return result
 }
 
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+// evalLogicalExpression evaluates && and ||, which only evaluate their right
+// operand when the left one does not decide the result.
+func (s *state) evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := s.eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+
+	if isTruthy(left) == (node.Operator == "||") {
+		return nativeBoolToBoolObject(isTruthy(left))
+	}
+
+	right := s.eval(node.Right, env)
+	if isAbrupt(right) {
+		return right
+	}
+
+	return nativeBoolToBoolObject(isTruthy(right))
+}
+
+func (s *state) evalInfixExpression(operator string, left, right object.Object) object.Object {
 	switch {
-	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
-	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
 	case operator == "==":
-		return nativeBoolToBoolObject(left == right)
+		return nativeBoolToBoolObject(object.Equal(left, right))
 	case operator == "!=":
-		return nativeBoolToBoolObject(left != right)
+		return nativeBoolToBoolObject(!object.Equal(left, right))
+	case left.Type() == object.CHAR_OBJ && right.Type() == object.CHAR_OBJ:
+		return s.evalCharInfixExpression(operator, left, right)
+	case isText(left) && isText(right):
+		return s.evalStringInfixExpression(operator, left, right)
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return s.evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() != right.Type():
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	default:
@@ -311,43 +592,110 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	}
 }
 
-func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+func (s *state) evalStringInfixExpression(operator string, left, right object.Object) object.Object {
 	if operator != "+" {
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
+	return s.alloc.NewString(text(left) + text(right))
+}
+
+func (s *state) evalCharInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.Char).Value
+	rightVal := right.(*object.Char).Value
 
-	return &object.String{Value: leftVal + rightVal}
+	switch operator {
+	case "+":
+		return s.alloc.NewString(string(leftVal) + string(rightVal))
+	case "<":
+		return nativeBoolToBoolObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBoolObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBoolObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBoolObject(leftVal >= rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// isText reports whether obj is a string or a char, which concatenate with
+// each other.
+func isText(obj object.Object) bool {
+	return obj.Type() == object.STRING_OBJ || obj.Type() == object.CHAR_OBJ
 }
 
-func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
+func text(obj object.Object) string {
+	if ch, ok := obj.(*object.Char); ok {
+		return string(ch.Value)
+	}
+	return obj.(*object.String).Value
+}
+
+// evalIntegerInfixExpression handles integers, which may be *object.Integer
+// or *object.BigInteger.
+func (s *state) evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	switch operator {
+	case "<":
+		return nativeBoolToBoolObject(object.CompareIntegers(left, right) < 0)
+	case ">":
+		return nativeBoolToBoolObject(object.CompareIntegers(left, right) > 0)
+	case "<=":
+		return nativeBoolToBoolObject(object.CompareIntegers(left, right) <= 0)
+	case ">=":
+		return nativeBoolToBoolObject(object.CompareIntegers(left, right) >= 0)
+	default:
+		return object.IntegerArithmetic(s, operator, left, right)
+	}
+}
+
+// evalFloatInfixExpression handles floats and mixed operands, promoting an
+// integer operand to a float.
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return &object.Float{Value: leftVal + rightVal}
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return &object.Float{Value: leftVal - rightVal}
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return &object.Float{Value: leftVal * rightVal}
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
 	case "<":
 		return nativeBoolToBoolObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBoolObject(leftVal > rightVal)
-	case "==":
-		return nativeBoolToBoolObject(leftVal == rightVal)
-	case "!=":
-		return nativeBoolToBoolObject(leftVal != rightVal)
+	case "<=":
+		return nativeBoolToBoolObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBoolObject(leftVal >= rightVal)
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInteger:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	default:
+		return obj.(*object.Float).Value
+	}
+}
+
 func nativeBoolToBoolObject(input bool) *object.Boolean {
 	if input {
 		return TRUE
@@ -355,12 +703,17 @@ func nativeBoolToBoolObject(input bool) *object.Boolean {
 	return FALSE
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func (s *state) evalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperator(right)
 	case "-":
-		return evalMinusPrefixOperatorExpression(right)
+		return s.evalMinusPrefixOperatorExpression(right)
+	case "~":
+		if right.Type() != object.INTEGER_OBJ {
+			return newError("unknown operator: ~%s", right.Type())
+		}
+		return object.IntegerPrefix(s, "~", right)
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
@@ -379,22 +732,37 @@ func evalBangOperator(right object.Object) object.Object {
 	}
 }
 
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+func (s *state) evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer, *object.BigInteger:
+		return object.IntegerPrefix(s, "-", right)
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
-func isError(obj object.Object) bool {
-	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+// withPosition attaches the position of node to obj if it is an error that
+// does not carry a position yet, so errors point at the innermost node that
+// produced them.
+func withPosition(obj object.Object, node ast.Node) object.Object {
+	if err, ok := obj.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+	return obj
+}
+
+// isAbrupt reports whether obj ends the evaluation of the expression that
+// produced it: an error, or a return, break or continue inside it, all of
+// which propagate out of the enclosing expressions.
+func isAbrupt(obj object.Object) bool {
+	if obj == nil {
+		return false
 	}
-	return false
+	return isReturnOrError(obj) || obj == BREAK || obj == CONTINUE
 }
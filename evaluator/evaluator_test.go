@@ -1,10 +1,13 @@
 package evaluator
 
 import (
+	"context"
 	"monkey-language/lexer"
 	"monkey-language/object"
 	"monkey-language/parser"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -58,15 +61,49 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
-func testByteObject(t *testing.T, obj object.Object, expected byte) bool {
-	result, ok := obj.(*object.Byte)
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"-.5", -0.5},
+		{"1.5 + 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2},
+		{"7 / 2.0", 3.5},
+		{"10 - 2.5 * 2", 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
 	if !ok {
-		t.Errorf("object is not an Byte. got=%T (+%v)", obj, obj)
+		t.Errorf("object is not a Float. got=%T (+%v)", obj, obj)
 		return false
 	}
 
 	if result.Value != expected {
-		t.Errorf("object has wrong value, got=%d, want=%d", result.Value, expected)
+		t.Errorf("object has wrong value, got=%g, want=%g", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testCharObject(t *testing.T, obj object.Object, expected rune) bool {
+	result, ok := obj.(*object.Char)
+	if !ok {
+		t.Errorf("object is not a Char. got=%T (+%v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value, got=%q, want=%q", result.Value, expected)
 		return false
 	}
 	return true
@@ -114,6 +151,161 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	return true
 }
 
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"7 % 3", 7 % 3},
+		{"-7 % 3", -7 % 3},
+		{"6 & 3", 6 & 3},
+		{"6 | 3", 6 | 3},
+		{"6 ^ 3", 6 ^ 3},
+		{"~5", ^5},
+		{"1 << 4", 1 << 4},
+		{"-16 >> 2", -16 >> 2},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"2 >= 3", false},
+		{"2.5 >= 2", true},
+		{"true && false", false},
+		{"1 && 2", true},
+		{"false || 0", true},
+		{"if (false) { 1 } || false", false},
+		{"1 << -1", "negative shift count: -1"},
+		{"~true", "unknown operator: ~BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error, got=%T (+%v)", evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("wrong error message, expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestLogicalOperatorsShortCircuit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"false && missing", false},
+		{"true || missing", true},
+		{"let f = fn() { 1 / 0 }; false && f()", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 5) { let i = i + 1; }; i", 5},
+		{"let i = 0; while (true) { let i = i + 1; if (i == 3) { break; } }; i", 3},
+		{"let n = 0; let i = 0; while (i < 10) { let i = i + 1; if (i % 2 == 0) { continue; } let n = n + i; }; n", 25},
+		{"let sum = 0; for (x in [1, 2, 3]) { let sum = sum + x; }; sum", 6},
+		{`let s = ""; for (c in "héllo") { if (c == "l"[0]) { continue; } let s = s + c; }; s`, "héo"},
+		{`let s = ""; for (k in {"b": 1, "a": 2}) { let s = s + k; }; s`, "ba"},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } }; f()", 20},
+		{"let f = fn() { while (false) {} }; f()", nil},
+		{"let s = 0; for (x in [1, 2, 3]) { s += 10 * if (x == 2) { continue } else { x } }; s", 40},
+		{"let s = 0; for (x in [1, 2, 3]) { let a = [s, if (x == 2) { break }]; s += x }; s", 1},
+		{"let f = fn() { let a = [1, 2 + if (true) { return 5 }]; 0 }; f()", 5},
+		{"let ff = fn() { let fs = []; for (x in [1, 2, 3]) { fs = push(fs, fn() { x }) }; fs[0]() }; ff()", 3},
+		{"for (x in 5) {}", "cannot iterate over INTEGER"},
+		{"while (missing) {}", "identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("String has wrong value, expected=%q, got=%q", expected, obj.Value)
+				}
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error message, expected=%q, got=%q", expected, obj.Message)
+				}
+			default:
+				t.Errorf("object is not String or Error, got=%T (+%v)", evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x = 2", 2},
+		{"let x = 1; let y = 1; x = y = 5; x + y", 10},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x %= 4; x", 2},
+		{"let x = 1; let f = fn() { x = 5 }; f(); x", 5},
+		{"let x = 1; let f = fn(x) { x = 5 }; f(0); x", 1},
+		{"let counter = fn() { let c = 0; fn() { c += 1 } }; let next = counter(); next(); next()", 2},
+		{"let i = 0; while (i < 5) { i += 1 }; i", 5},
+		{"let a = [1, 2, 3]; a[1] = 20; a[1]", 20},
+		{"let a = [1, 2, 3]; a[2] *= 10; a[2]", 30},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] += 10; h["a"] + h["b"]`, 13},
+		{"let a = [[1], [2]]; a[1][0] = 5; a[1][0]", 5},
+		{"x = 1", "cannot assign to undefined identifier: x"},
+		{"x += 1", "identifier not found: x"},
+		{"len = 1", "cannot assign to undefined identifier: len"},
+		{"let a = [1]; a[1] = 2", "index out of range: 1"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+		{`let h = {}; h[fn() {}] = 1`, "unusable as hash key: FUNCTION"},
+		{`let x = "a"; x -= 1`, "unknown operator: STRING - INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error, got=%T (+%v)", evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("wrong error message, expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func TestBankOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -230,6 +422,8 @@ func TestErrorHandling(t *testing.T) {
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
 		},
+		{"1 / 0", "division by zero"},
+		{"let x = 0; 5 % x", "division by zero"},
 	}
 
 	for _, tt := range tests {
@@ -341,6 +535,11 @@ func TestBuiltinFunction(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
+		{`len(bytes("héllo"))`, 6},
+		{`bytes("é")[1]`, 0xa9},
+		{`len(chars("日本語"))`, 3},
+		{`bytes(1)`, "argument to `bytes` must be STRING, got INTEGER"},
 		{`len(1)`, "argument to `len` not supported, got=INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 	}
@@ -463,21 +662,32 @@ func TestStringIndexesExpressions(t *testing.T) {
 			`let myString = "abc"; myString[2];`,
 			'c',
 		},
+		{
+			`"héllo"[1]`,
+			'é',
+		},
+		{
+			`"日本語"[2]`,
+			'語',
+		},
 		{
 			`"abc"[3]`,
 			nil,
 		}, {
 			`"abc"[-1]`,
 			nil,
+		}, {
+			`"日本語"[3]`,
+			nil,
 		},
 	}
 
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
-		expectedByte, ok := tt.expected.(int32)
+		expectedChar, ok := tt.expected.(int32)
 
 		if ok {
-			testByteObject(t, evaluated, byte(expectedByte))
+			testCharObject(t, evaluated, expectedChar)
 		} else {
 			testNullObject(t, evaluated)
 		}
@@ -510,12 +720,12 @@ func TestHashLiterals(t *testing.T) {
 		FALSE.HashKey():                            6,
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
 	}
 
 	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+		pair, ok := result.Get(expectedKey)
 
 		if !ok {
 			t.Errorf("no pair for given key in Pairs")
@@ -525,6 +735,237 @@ func TestHashLiterals(t *testing.T) {
 	}
 }
 
+func TestEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"abc" == "abc"`, true},
+		{`"abc" != "abd"`, true},
+		{`"a" == "a"[0]`, false},
+		{"[1, [2, 3]] == [1, [2, 3]]", true},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] != [1, 2, 3]", true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{"1 == 1.0", true},
+		{"(1 << 70) == (1 << 70)", true},
+		{"[][0] == [1][1]", true},
+		{"let f = fn() {}; f == f", true},
+		{"fn() {} == fn() {}", false},
+		{"let a = [1]; let b = [1]; a[0] = a; b[0] = b; a == b", true},
+		{"let a = [1]; is(a, a)", true},
+		{"is([1], [1])", false},
+		{`is({}, {})`, false},
+		{`is("ab", "a" + "b")`, true},
+		{"is(1 << 70, 1 << 70)", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"map([1, 2, 3], fn(x) { x * 2 })", "[2, 4, 6]"},
+		{`map("ab", fn(c) { c + "!" })`, "[a!, b!]"},
+		{`map({"a": 1, "b": 2}, fn(k) { k })`, "[a, b]"},
+		{"map([1, 2], len)", "ERROR: 1:4: argument to `len` not supported, got=INTEGER"},
+		{"filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })", "[2, 4]"},
+		{"filter([1, 2], fn(x) { 0 })", "[1, 2]"},
+		{"reduce([1, 2, 3], fn(acc, x) { acc + x })", "6"},
+		{"reduce([1, 2, 3], fn(acc, x) { push(acc, x * x) }, [])", "[1, 4, 9]"},
+		{"reduce([], fn(acc, x) { acc + x }, 0)", "0"},
+		{"reduce([], fn(acc, x) { acc + x })", "ERROR: 1:7: `reduce` of an empty collection without an initial value"},
+		{"sort([3, 1.5, 2, 1 << 70, -1])", "[-1, 1.5, 2, 3, 1180591620717411303424]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{"sort([3, 1, 2], fn(a, b) { a > b })", "[3, 2, 1]"},
+		{"let a = [2, 1]; sort(a); a", "[2, 1]"},
+		{`sort([[2, "a"], [1, "b"], [2, "c"], [1, "d"]], fn(a, b) { a[0] < b[0] })`, "[[1, b], [1, d], [2, a], [2, c]]"},
+		{`sort([1, "a"])`, "ERROR: 1:5: unknown operator: STRING < INTEGER"},
+		{"sort([2, 1], fn(a, b) { a + true })", "ERROR: 1:27: unknown operator: INTEGER + BOOLEAN"},
+		{`zip([1, 2, 3], "ab")`, "[[1, a], [2, b]]"},
+		{"zip([1], [])", "[]"},
+		{"zip(1)", "ERROR: 1:4: argument to `zip` must be ARRAY, STRING or HASH, got INTEGER"},
+		{"any([1, 2], fn(x) { x > 1 })", "true"},
+		{"any([], fn(x) { true })", "false"},
+		{"all([1, 2], fn(x) { x > 1 })", "false"},
+		{"all([], fn(x) { false })", "true"},
+		{"find([1, 2, 3], fn(x) { x > 1 })", "2"},
+		{"find([1, 2, 3], fn(x) { x > 5 })", "null"},
+		{"range(4)", "[0, 1, 2, 3]"},
+		{"range(2, 5)", "[2, 3, 4]"},
+		{"range(5, 0, -2)", "[5, 3, 1]"},
+		{"range(3, 1)", "[]"},
+		{"range(0, 1, 0)", "ERROR: 1:6: `range` step must not be 0"},
+		{"range(-9223372036854775807 - 1, 9223372036854775807)", "ERROR: 1:6: `range` too large: 18446744073709551615 elements"},
+		{"range(1 << 70)", "ERROR: 1:6: argument to `range` out of range: 1180591620717411303424"},
+		{"range(4194305)", "ERROR: 1:6: `range` too large: 4194305 elements"},
+		{"len(range(4194304))", "4194304"},
+		{"reverse([1, 2, 3])", "[3, 2, 1]"},
+		{`reverse("héllo")`, "olléh"},
+		{"map(reverse([1, 2]), fn(x) { range(x) })", "[[0, 1], [0]]"},
+		{"let n = 0; map([1, 2, 3], fn(x) { n += x }); n", "6"},
+		{`try { map([1, 2], fn(x) { if (x == 2) { throw "two" } x }) } catch (e) { e }`, "two"},
+		{"map([1], fn(x) { filter([1, 2], fn(y) { y > x }) })", "[[2]]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q, expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b,,c", ",")`, "[a, b, , c]"},
+		{`split("  a  b ")`, "[a, b]"},
+		{`split("héllo", "")`, "[h, é, l, l, o]"},
+		{`join(["a", "b", "c"], ", ")`, "a, b, c"},
+		{`join(chars("abc"))`, "abc"},
+		{`join([1], ",")`, "ERROR: 1:5: elements of `join` must be STRING or CHAR, got INTEGER"},
+		{`trim("  a b \n")`, "a b"},
+		{`trim("xxaxx", "x")`, "a"},
+		{`[upper("héllo"), lower("ÉA")]`, "[HÉLLO, éa]"},
+		{`upper(1)`, "ERROR: 1:6: argument to `upper` must be STRING, got INTEGER"},
+		{`[contains("hello", "ell"), contains("hello", "z"), contains([1, [2]], [2]), contains("abc", "abc"[1])]`, "[true, false, true, true]"},
+		{`[index_of("héllo", "l"), index_of("abc", "z"), index_of([1, 2, 3], 3.0)]`, "[2, -1, 2]"},
+		{`contains(1, 1)`, "ERROR: 1:9: argument to `contains` must be STRING or ARRAY, got INTEGER"},
+		{`[replace("aaa", "a", "b"), replace("aaa", "a", "b", 2)]`, "[bbb, bba]"},
+		{`[starts_with("hello", "he"), ends_with("hello", "he")]`, "[true, false]"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab", -1)`, "ERROR: 1:7: negative `repeat` count: -1"},
+		{`repeat("ab", 1 << 62)`, "ERROR: 1:7: `repeat` result too large: 9223372036854775808 bytes"},
+		{`[substr("héllo", 1, 3), substr("héllo", 3), substr("abc", 5), substr("abc", 1, 10)]`, "[éll, lo, , bc]"},
+		{`substr("abc", -1)`, "ERROR: 1:7: negative `substr` bound: -1"},
+		{`repeat("ab", 1 << 70)`, "ERROR: 1:7: argument to `repeat` out of range: 1180591620717411303424"},
+		{`substr("abc", 0, 1 << 70)`, "ERROR: 1:7: argument to `substr` out of range: 1180591620717411303424"},
+		{`replace("a", "a", "b", -(1 << 70))`, "ERROR: 1:8: argument to `replace` out of range: -1180591620717411303424"},
+		{`to_string(1, 1 << 70)`, "ERROR: 1:10: argument to `to_string` out of range: 1180591620717411303424"},
+		{`format("%s has %d items costing %.2f: %v", "cart", 3, 1.5, [1, true])`, "cart has 3 items costing 1.50: [1, true]"},
+		{`format("%x %t %s", 1 << 70, false, "a"[0])`, "400000000000000000 false a"},
+		{`format("%5.1f%% %c%c %q %s", 2, 65, "é"[0], "a", [1])`, `  2.0% Aé "a" [1]`},
+		{`format("%d", "x")`, "ERROR: 1:7: argument to `format` for %d must be INTEGER, got STRING"},
+		{`format("%-4t", 1)`, "ERROR: 1:7: argument to `format` for %-4t must be BOOLEAN, got INTEGER"},
+		{`format("%d")`, "ERROR: 1:7: wrong number of arguments. got=1, want=2"},
+		{`format("%d", 1, 2)`, "ERROR: 1:7: wrong number of arguments. got=3, want=2"},
+		{`format("%*d", 1, 2)`, "ERROR: 1:7: unknown `format` verb: %*"},
+		{`format("50%")`, "ERROR: 1:7: `format` ends with an incomplete verb: %"},
+		{`[to_int("42"), to_int("-7"), to_int("ff", 16), to_int("0x1f", 0), to_int(3.9), to_int(-3.9)]`, "[42, -7, 255, 31, 3, -3]"},
+		{`to_int("123456789012345678901234567890")`, "123456789012345678901234567890"},
+		{`to_int("abc")`, `ERROR: 1:7: invalid integer: "abc"`},
+		{`to_int("1", 37)`, "ERROR: 1:7: invalid base: 37"},
+		{`to_int(true)`, "ERROR: 1:7: argument to `to_int` must be STRING, FLOAT or INTEGER, got BOOLEAN"},
+		{`[to_string(42), to_string(255, 2), to_string(1.5), to_string([1, "a"]), to_string("s")]`, "[42, 11111111, 1.5, [1, a], s]"},
+		{`to_string(42) + "!"`, "42!"},
+		{`to_string(1.5, 2)`, "ERROR: 1:10: argument to `to_string` with a base must be INTEGER, got FLOAT"},
+		{`join(map(split("a b c"), upper), "-")`, "A-B-C"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q, expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`keys({"b": 1, "a": 2, 3: 3})`, "[b, a, 3]"},
+		{`values({"b": 1, "a": 2})`, "[1, 2]"},
+		{`entries({"b": 1, "a": [2]})`, "[[b, 1], [a, [2]]]"},
+		{`keys({})`, "[]"},
+		{`[has({"a": 1}, "a"), has({"a": 1}, "b"), has({1: 1}, 1.0)]`, "[true, false, true]"},
+		{`has({}, [])`, "ERROR: 1:4: unusable as hash key: ARRAY"},
+		{`delete({"a": 1, "b": 2, "c": 3}, "b")`, "{a: 1, c: 3}"},
+		{`delete({"a": 1}, "z")`, "{a: 1}"},
+		{`let h = {"a": 1}; delete(h, "a"); h`, "{a: 1}"},
+		{`merge({"a": 1, "b": 2}, {"c": 3, "a": 4}, {"d": 5})`, "{a: 4, b: 2, c: 3, d: 5}"},
+		{`let h = {"a": 1}; let m = merge(h); m["b"] = 2; [h, m]`, "[{a: 1}, {a: 1, b: 2}]"},
+		{`merge({}, [])`, "ERROR: 1:6: argument to `merge` must be HASH, got ARRAY"},
+		{`keys([1])`, "ERROR: 1:5: argument to `keys` must be HASH, got ARRAY"},
+		{`keys({}, 1)`, "ERROR: 1:5: wrong number of arguments. got=2, want=1"},
+		{`let s = ""; for (e in entries({"x": 1, "y": 2})) { s += e[0] + to_string(e[1]) }; s`, "x1y2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q, expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2].push(3)", "[1, 2, 3]"},
+		{"[3, 1, 2].sort().map(fn(x) { x * 10 }).filter(fn(x) { x > 10 })", "[20, 30]"},
+		{`"a b c".split().map(upper).join("-")`, "A-B-C"},
+		{`"  Hi ".trim().lower().len()`, "2"},
+		{`{"b": 1, "a": 2}.keys()`, "[b, a]"},
+		{`{"a": 1}.len()`, "1"},
+		{`let h = {"name": "monkey", "age": 3}; [h.name, h.age, h.missing]`, "[monkey, 3, null]"},
+		{`let h = {"keys": 1}; [h.keys(), h["keys"]]`, "[[keys], 1]"},
+		{`let h = {"f": fn(x) { x + 1 }}; h.f(1)`, "2"},
+		{"42.to_string().len()", "2"},
+		{"1.5.to_int()", "1"},
+		{`"a"[0].repeat(3)`, "aaa"},
+		{"let push = [1].push; push(2)", "[1, 2]"},
+		{"[1].nope()", "ERROR: 1:4: unknown method: ARRAY.nope"},
+		{"5.x", "ERROR: 1:2: unknown method: INTEGER.x"},
+		{`[1].push(1, 2)`, "ERROR: 1:9: wrong number of arguments. got=3, want=2"},
+		{"fn() {}.x", "ERROR: 1:8: unknown method: FUNCTION.x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q, expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, 3: 3, true: 4}`, "{b: 1, a: 2, 3: 3, true: 4}"},
+		{`{"b": 1, "a": 2, "b": 3}`, "{b: 3, a: 2}"},
+		{`let h = {"z": 1}; h["y"] = 2; h["z"] = 3; h`, "{z: 3, y: 2}"},
+		{`let log = []; let f = fn(x) { log = push(log, x); x }; {f("c"): f(1), f("a"): f(2), f("b"): f(3)}; log`, "[c, 1, a, 2, b, 3]"},
+		{`let ks = []; for (k in {"c": 1, "a": 2, "b": 3}) { ks = push(ks, k) }; ks`, "[c, a, b]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q, expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestHashIndexExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -570,3 +1011,364 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"const x = 5; x * 2", 10},
+		{"const x = 5; let f = fn() { const x = 1; x }; f() + x", 6},
+		{"const x = 5; let f = fn(x) { x = 1; x }; f(0)", 1},
+		{"let s = 0; for (i in [1, 2, 3]) { const d = i * 2; s += d }; s", 12},
+		{"let x = 1; const x = 2; x", 2},
+		{"const x = 5; x = 1", "cannot assign to constant: x"},
+		{"const x = 5; x += 1", "cannot assign to constant: x"},
+		{"const x = 5; let f = fn() { x = 1 }; f()", "cannot assign to constant: x"},
+		{"const x = 5; let x = 1", "cannot redeclare constant: x"},
+		{"const x = 5; const x = 1", "cannot redeclare constant: x"},
+		{"const x = 5; for (x in [1]) {}", "cannot redeclare constant: x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error, got=%T (+%v)", evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("wrong error message, expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true;", "1:3"},
+		{"let x = 1;\nlet y = x + foo;", "2:13"},
+		{"let f = fn(a) {\n  a + true;\n};\nf(1);", "2:5"},
+		{"len(1)", "1:4"},
+		{`{"a": 1}[fn(x) { x }]`, "1:9"},
+		{`let h = {"a": 1, [1]: 2}`, "1:18"},
+		{"const x = 1;\nx = 2", "2:3"},
+		{"const x = 1;\nlet x = 2", "2:5"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned, got=%T(+%v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Pos.String() != tt.expected {
+			t.Errorf("wrong error position for %q, expected=%q, got=%q", tt.input, tt.expected, errObj.Pos.String())
+		}
+	}
+}
+
+func TestStackTraces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + true", ""},
+		{"let f = fn(a) { a }; f(1, 2)", ""},
+		{
+			"let add = fn(a, b) {\n  a + b\n};\nlet apply = fn(f) { f(1, true) };\napply(add);",
+			"  at add (4:22)\n  at apply (5:6)\n",
+		},
+		{"fn() { 1 + true }()", "  at fn (1:18)\n"},
+		{
+			"let f = fn(x) { x + true };\nmap([1], f)",
+			"  at f (2:4)\n",
+		},
+		{
+			"let f = fn(n) { if (n == 0) { n + true } else { f(n - 1) } }; f(30)",
+			strings.Repeat("  at f (1:50)\n", 20) + "  ... 11 more\n",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q, got=%T(+%v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.StackTrace() != tt.expected {
+			t.Errorf("wrong stack trace for %q, expected=\n%s\ngot=\n%s", tt.input, tt.expected, errObj.StackTrace())
+		}
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"let f = fn(n) { if (n < 2) { 1 } else { n * f(n - 1) } }; f(25)", "15511210043330985984000000"},
+		{"let x = 9223372036854775807 * 4; x / 4", "9223372036854775807"},
+		{"let x = 9223372036854775807 * 4; x - x + 1", "1"},
+		{"let x = 1 << 70; [x > 1, x < 1, x == 1 << 70, x != 1 << 70, -x < x]", "[true, false, true, false, true]"},
+		{"(1 << 70) + 0.5", "1.1805916207174113e+21"},
+		{"let x = 1 << 70; {x: 1}[1 << 70]", "1"},
+		{"let x = 1 << 70; {x: 1}[0]", "null"},
+		{"[1, 2][1 << 70]", "null"},
+		{`"ab"[1 << 70]`, "null"},
+		{"let a = [1]; a[1 << 70] = 2", "ERROR: 1:25: index out of range: 1180591620717411303424"},
+		{"~(1 << 70)", "-1180591620717411303425"},
+		{"(1 << 70) >> 69", "2"},
+		{"-(1 << 63)", "-9223372036854775808"},
+		{"9223372036854775808", "9223372036854775808"},
+		{"-9223372036854775808 == -9223372036854775807 - 1", "true"},
+		{"123456789012345678901234567890 / 10", "12345678901234567890123456789"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q, expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		overflow object.Overflow
+		expected interface{}
+	}{
+		{"9223372036854775807 + 1", object.OverflowWrap, int64(-9223372036854775808)},
+		{"let min = -9223372036854775807 - 1; -min", object.OverflowWrap, int64(-9223372036854775808)},
+		{"9223372036854775807 + 1", object.OverflowError, "integer overflow: 9223372036854775807 + 1"},
+		{"4611686018427387904 * 2", object.OverflowError, "integer overflow: 4611686018427387904 * 2"},
+		{"1 << 63", object.OverflowError, "integer overflow: 1 << 63"},
+		{"let min = -9223372036854775807 - 1; -min", object.OverflowError, "integer overflow: -(-9223372036854775808)"},
+		{"4611686018427387904 * -2", object.OverflowError, int64(-9223372036854775808)},
+		{`try { 9223372036854775807 + 1 } catch (e) { e["kind"] }`, object.OverflowError, "OVERFLOW"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalContext(context.Background(), program, object.NewEnvironment(), WithOverflow(tt.overflow))
+
+		switch expected := tt.expected.(type) {
+		case int64:
+			testIntegerObject(t, evaluated, expected)
+		case string:
+			switch result := evaluated.(type) {
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("wrong result for %q, expected=%q, got=%q", tt.input, expected, result.Value)
+				}
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("wrong error message for %q, expected=%q, got=%q", tt.input, expected, result.Message)
+				}
+			default:
+				t.Errorf("wrong result for %q, got=%T (%+v)", tt.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"try { 1 } catch (e) { 2 }", 1},
+		{`try { 1 + true } catch (e) { e["message"] }`, "unknown operator: INTEGER + BOOLEAN"},
+		{`try { 1 + true } catch (e) { e["kind"] }`, "ERROR"},
+		{`try { throw "bad" } catch (e) { e }`, "bad"},
+		{`try { throw {"code": 7} } catch (e) { e["code"] }`, 7},
+		{`let f = fn() { throw 3 }; try { f() } catch (e) { e }`, 3},
+		{`try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e }`, 2},
+		{"let x = 0; try { x = 1 } finally { x += 10 }; x", 11},
+		{"let x = 0; try { try { throw 1 } finally { x = 5 } } catch (e) { x + e }", 6},
+		{"let f = fn() { try { return 1 } finally { return 2 } }; f()", 2},
+		{"let f = fn() { try { throw 1 } finally { return 2 } }; f()", 2},
+		{"let s = 0; for (i in [1, 2, 3]) { try { if (i == 2) { continue } s += i } finally { s += 10 } }; s", 34},
+		{"let s = 0; while (true) { try { break } finally { s = 1 } }; s", 1},
+		{"let f = fn() { f() }; try { f() } catch (e) { e[\"kind\"] }", "STACK_OVERFLOW"},
+		{"const e = 1; try { throw 2 } catch (e) { e }", "cannot redeclare constant: e"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			switch result := evaluated.(type) {
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("wrong result for %q, expected=%q, got=%q", tt.input, expected, result.Value)
+				}
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("wrong error message for %q, expected=%q, got=%q", tt.input, expected, result.Message)
+				}
+			default:
+				t.Errorf("wrong result for %q, got=%T (%+v)", tt.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestUncaughtThrow(t *testing.T) {
+	evaluated := testEval("let f = fn() {\n  throw {\"message\": \"bad\"}\n};\nf()")
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned, got=%T(+%v)", evaluated, evaluated)
+	}
+
+	if errObj.Message != "bad" || errObj.Pos.String() != "2:3" {
+		t.Errorf("wrong error, got=%s: %q", errObj.Pos, errObj.Message)
+	}
+
+	if _, ok := errObj.Value.(*object.Hash); !ok {
+		t.Errorf("thrown value is not Hash, got=%T", errObj.Value)
+	}
+
+	if errObj.StackTrace() != "  at f (4:2)\n" {
+		t.Errorf("wrong stack trace, got=%q", errObj.StackTrace())
+	}
+}
+
+func TestEvaluationLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	expired, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	tests := []struct {
+		input           string
+		ctx             context.Context
+		opts            []Option
+		expectedKind    object.ErrorKind
+		expectedMessage string
+	}{
+		{
+			"let f = fn() { f() }; f()", context.Background(), nil,
+			object.STACK_OVERFLOW_ERR, "stack overflow: maximum call depth of 10000 exceeded",
+		},
+		{
+			"let f = fn(n) { if (n > 0) { f(n - 1) } }; f(5)", context.Background(), []Option{WithMaxDepth(5)},
+			object.STACK_OVERFLOW_ERR, "stack overflow: maximum call depth of 5 exceeded",
+		},
+		{
+			"while (true) {}", context.Background(), []Option{WithStepLimit(100)},
+			object.STEP_LIMIT_ERR, "step limit of 100 exceeded",
+		},
+		{
+			`let s = "x"; while (true) { s = s + s }`, context.Background(), []Option{WithMemoryLimit(1 << 20)},
+			object.MEMORY_LIMIT_ERR, "memory limit of 1048576 bytes exceeded",
+		},
+		{
+			"let a = []; while (true) { a = push(a, 1) }", context.Background(), []Option{WithMemoryLimit(1 << 20)},
+			object.MEMORY_LIMIT_ERR, "memory limit of 1048576 bytes exceeded",
+		},
+		{
+			"let h = {}; let i = 0; while (true) { h[i] = i; i += 1 }", context.Background(), []Option{WithMemoryLimit(1 << 20)},
+			object.MEMORY_LIMIT_ERR, "memory limit of 1048576 bytes exceeded",
+		},
+		{
+			"let x = 1 << 64; while (true) { x = x * x }", context.Background(), []Option{WithMemoryLimit(1 << 20)},
+			object.MEMORY_LIMIT_ERR, "memory limit of 1048576 bytes exceeded",
+		},
+		{
+			"1 + 2", cancelled, nil,
+			object.CANCELLED_ERR, "evaluation cancelled",
+		},
+		{
+			"while (true) {}", expired, nil,
+			object.TIMEOUT_ERR, "evaluation timed out",
+		},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := EvalContext(tt.ctx, program, object.NewEnvironment(), tt.opts...)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q, got=%T(+%v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Kind != tt.expectedKind {
+			t.Errorf("wrong error kind for %q, expected=%q, got=%q", tt.input, tt.expectedKind, errObj.Kind)
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message for %q, expected=%q, got=%q", tt.input, tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestEvaluationWithinLimits(t *testing.T) {
+	input := "let f = fn(n) { if (n > 0) { f(n - 1) } else { n } }; f(5)"
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	evaluated := EvalContext(context.Background(), program, object.NewEnvironment(), WithMaxDepth(6), WithStepLimit(1000), WithMemoryLimit(1000))
+	testIntegerObject(t, evaluated, 0)
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+	let newAdder = fn(x) {
+		fn(y) { x + y };
+	};
+
+	let addTwo = newAdder(2);
+	addTwo(2);`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	input := `
+	let fibonacci = fn(x) {
+		if (x < 2) { return x; }
+		fibonacci(x - 1) + fibonacci(x - 2);
+	};
+	fibonacci(15);`
+
+	testIntegerObject(t, testEval(input), 610)
+}
+
+func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+	evaluated := testEval("fn(a, b) { a + b; }(1);")
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned, got=%T(+%v)", evaluated, evaluated)
+	}
+
+	expected := "wrong number of arguments: want=2, got=1"
+	if errObj.Message != expected {
+		t.Errorf("wrong error message, expected=%q, got=%q", expected, errObj.Message)
+	}
+}
@@ -0,0 +1,109 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"monkey-language/ast"
+	"monkey-language/object"
+	"monkey-language/token"
+)
+
+// DefaultMaxDepth is the call depth at which evaluation stops with a
+// STACK_OVERFLOW error unless WithMaxDepth sets another one, so that runaway
+// recursion cannot overflow the Go stack.
+const DefaultMaxDepth = 10000
+
+type Option func(*state)
+
+// WithStepLimit stops evaluation with a STEP_LIMIT error once more than n
+// nodes have been evaluated. Zero, the default, means no limit.
+func WithStepLimit(n int) Option {
+	return func(s *state) {
+		s.stepLimit = n
+	}
+}
+
+// WithMaxDepth sets how deeply function calls may nest.
+func WithMaxDepth(n int) Option {
+	return func(s *state) {
+		s.maxDepth = n
+	}
+}
+
+// WithMemoryLimit stops evaluation with a MEMORY_LIMIT error once the
+// strings, arrays, hashes and big integers it creates add up to more than n bytes, as
+// estimated by object.Allocator. Zero, the default, means no limit.
+func WithMemoryLimit(n int) Option {
+	return func(s *state) {
+		s.alloc = object.NewAllocator(n)
+	}
+}
+
+// WithOverflow sets what integer arithmetic does when a result does not fit
+// in an int64, by default object.OverflowPromote.
+func WithOverflow(o object.Overflow) Option {
+	return func(s *state) {
+		s.overflow = o
+	}
+}
+
+// state holds what a single evaluation keeps track of besides environments.
+type state struct {
+	ctx  context.Context
+	done <-chan struct{}
+
+	steps     int
+	stepLimit int
+	depth     int
+	maxDepth  int
+
+	alloc    *object.Allocator
+	overflow object.Overflow
+
+	// builtinPos is where the builtin being run was called from, which is
+	// where the functions it calls are called from too.
+	builtinPos token.Position
+}
+
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	return EvalContext(context.Background(), node, env)
+}
+
+// EvalContext is like Eval, but stops with a CANCELLED or TIMEOUT error when
+// ctx is done and applies the limits set by opts.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, opts ...Option) object.Object {
+	s := &state{ctx: ctx, done: ctx.Done(), maxDepth: DefaultMaxDepth}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s.eval(node, env)
+}
+
+func (s *state) Allocator() *object.Allocator { return s.alloc }
+func (s *state) Overflow() object.Overflow    { return s.overflow }
+
+func (s *state) Call(fn object.Object, args ...object.Object) object.Object {
+	return s.applyFunction(fn, args, s.builtinPos)
+}
+
+// step counts the evaluation of a node and returns an error if evaluation
+// has to stop.
+func (s *state) step() *object.Error {
+	s.steps++
+	if s.stepLimit > 0 && s.steps > s.stepLimit {
+		return &object.Error{
+			Kind:    object.STEP_LIMIT_ERR,
+			Message: fmt.Sprintf("step limit of %d exceeded", s.stepLimit),
+		}
+	}
+
+	select {
+	case <-s.done:
+		if s.ctx.Err() == context.DeadlineExceeded {
+			return &object.Error{Kind: object.TIMEOUT_ERR, Message: "evaluation timed out"}
+		}
+		return &object.Error{Kind: object.CANCELLED_ERR, Message: "evaluation cancelled"}
+	default:
+		return nil
+	}
+}
@@ -1,46 +1,137 @@
 package lexer
 
-import "monkey-language/token"
+import (
+	"fmt"
+	"monkey-language/diagnostic"
+	"monkey-language/token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 type Lexer struct {
 	input        string
+	filename     string
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
+	ch           rune // current char under examination
+	line         int  // line of the current char
+	column       int  // column of the current char, counted in chars
+
+	keepComments bool
+	errors       []*diagnostic.Diagnostic
+}
+
+type Option func(*Lexer)
+
+// WithFilename sets the filename recorded in the position of every token.
+func WithFilename(filename string) Option {
+	return func(l *Lexer) {
+		l.filename = filename
+	}
 }
 
-func New(input string) *Lexer {
-	l := &Lexer{input: input}
+// WithComments makes the lexer return comments as token.COMMENT instead of
+// skipping them, for tools that need to keep them.
+func WithComments() Option {
+	return func(l *Lexer) {
+		l.keepComments = true
+	}
+}
+
+func New(input string, opts ...Option) *Lexer {
+	l := &Lexer{input: input, line: 1}
+	for _, opt := range opts {
+		opt(l)
+	}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
-	l.ch = l.peekChar()
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+
+	width := 0
+	if l.readPosition < len(l.input) {
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
+	} else {
+		l.ch = 0
+	}
+
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += width
+	l.column += 1
+}
+
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
+}
+
+func (l *Lexer) peekChar() rune {
+	return l.peekCharAt(0)
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+// peekCharAt returns the char n chars after the next one.
+func (l *Lexer) peekCharAt(n int) rune {
+	position := l.readPosition
+	for ; n > 0 && position < len(l.input); n-- {
+		_, width := utf8.DecodeRuneInString(l.input[position:])
+		position += width
+	}
+
+	if position >= len(l.input) {
 		return 0
 	}
 
-	return l.input[l.readPosition]
+	ch, _ := utf8.DecodeRuneInString(l.input[position:])
+	return ch
+}
+
+// Errors returns the diagnostics for the ILLEGAL tokens returned so far.
+func (l *Lexer) Errors() []*diagnostic.Diagnostic {
+	return l.errors
 }
 
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
-	l.skipWhitespace()
+	for {
+		l.skipWhitespace()
+		if l.ch != '/' || (l.peekChar() != '/' && l.peekChar() != '*') {
+			break
+		}
+
+		pos := l.currentPosition()
+		literal, terminated := l.readComment()
+		tok = token.Token{Type: token.COMMENT, Literal: literal, Pos: pos, End: l.currentPosition()}
+
+		if !terminated {
+			tok.Type = token.ILLEGAL
+			d := l.illegal(diagnostic.UnterminatedComment, tok, "unterminated block comment")
+			d.Fix = "insert \"*/\""
+			return tok
+		}
+
+		if l.keepComments {
+			return tok
+		}
+	}
+
+	pos := l.currentPosition()
 
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
-			ch := l.ch
-			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.EQ, Literal: literal}
+			tok = l.twoCharToken(token.EQ)
 		} else {
 			tok = newToken(token.ASSING, l.ch)
 		}
@@ -51,26 +142,75 @@ func (l *Lexer) NextToken() token.Token {
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.twoCharToken(token.PLUS_ASSIGN)
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.twoCharToken(token.MINUS_ASSIGN)
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.twoCharToken(token.SLASH_ASSIGN)
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
-			ch := l.ch
-			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.NOT_EQ, Literal: literal}
+			tok = l.twoCharToken(token.NOT_EQ)
 		} else {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.twoCharToken(token.ASTERISK_ASSIGN)
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		if l.peekChar() == '=' {
+			tok = l.twoCharToken(token.PERCENT_ASSIGN)
+		} else {
+			tok = newToken(token.PERCENT, l.ch)
+		}
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		switch l.peekChar() {
+		case '=':
+			tok = l.twoCharToken(token.LT_EQ)
+		case '<':
+			tok = l.twoCharToken(token.SHL)
+		default:
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		switch l.peekChar() {
+		case '=':
+			tok = l.twoCharToken(token.GT_EQ)
+		case '>':
+			tok = l.twoCharToken(token.SHR)
+		default:
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			tok = l.twoCharToken(token.AND)
+		} else {
+			tok = newToken(token.BIT_AND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok = l.twoCharToken(token.OR)
+		} else {
+			tok = newToken(token.BIT_OR, l.ch)
+		}
+	case '^':
+		tok = newToken(token.BIT_XOR, l.ch)
+	case '~':
+		tok = newToken(token.BIT_NOT, l.ch)
 	case '{':
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
@@ -80,9 +220,8 @@ func (l *Lexer) NextToken() token.Token {
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
-	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+	case '"', '`':
+		return l.readString(pos)
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
@@ -93,20 +232,79 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos, tok.End = pos, l.currentPosition()
 			return tok
-		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+		} else if isDigit(l.ch) || l.ch == '.' && isDigit(l.peekChar()) {
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos, tok.End = pos, l.currentPosition()
+			if tok.Type == token.ILLEGAL {
+				l.illegal(diagnostic.InvalidExponent, tok, "exponent without digits in %q", tok.Literal)
+			}
 			return tok
+		} else if l.ch == '.' {
+			tok = newToken(token.DOT, l.ch)
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			tok = token.Token{Type: token.ILLEGAL, Literal: l.input[l.position:l.readPosition]}
 		}
 	}
 
 	l.readChar()
+	tok.Pos, tok.End = pos, l.currentPosition()
+
+	if tok.Type == token.ILLEGAL {
+		l.illegal(diagnostic.IllegalCharacter, tok, "illegal character %q", tok.Literal)
+	}
+
 	return tok
 }
 
+// twoCharToken consumes the current char and returns a token made of it and
+// the next one, which is left as the current char.
+func (l *Lexer) twoCharToken(tokenType token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: tokenType, Literal: string(ch) + string(l.ch)}
+}
+
+func (l *Lexer) illegal(code diagnostic.Code, tok token.Token, format string, a ...interface{}) *diagnostic.Diagnostic {
+	d := diagnostic.New(code, tok, format, a...)
+	l.errors = append(l.errors, d)
+	return d
+}
+
+// readComment reads a "//" comment up to the end of the line, or a "/* */"
+// comment, which may nest. It reports whether a block comment was closed.
+func (l *Lexer) readComment() (string, bool) {
+	position := l.position
+
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		return l.input[position:l.position], true
+	}
+
+	l.readChar()
+	l.readChar()
+
+	depth := 1
+	for depth > 0 {
+		switch {
+		case l.ch == 0:
+			return l.input[position:l.position], false
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+		}
+		l.readChar()
+	}
+
+	return l.input[position:l.position], true
+}
+
 func (l *Lexer) readIdentifier() string {
 	position := l.position
 	for isLetter(l.ch) {
@@ -115,23 +313,156 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1
-	for {
+// readString reads a double-quoted string, decoding its escape sequences, or
+// a raw backtick string, which is taken as is and may span lines. A string
+// that is not closed, or has an invalid escape, is returned as ILLEGAL.
+func (l *Lexer) readString(pos token.Position) token.Token {
+	quote := l.ch
+	var value strings.Builder
+	var escapeErrors []*diagnostic.Diagnostic
+
+	l.readChar()
+	for l.ch != quote {
+		if l.ch == 0 || quote == '"' && l.ch == '\n' {
+			tok := l.tokenFrom(token.ILLEGAL, pos)
+			d := l.illegal(diagnostic.UnterminatedString, tok, "unterminated string literal")
+			d.Fix = fmt.Sprintf("insert '%c'", quote)
+			return tok
+		}
+
+		if quote == '"' && l.ch == '\\' {
+			if d := l.readEscape(&value); d != nil {
+				escapeErrors = append(escapeErrors, d)
+			}
+			continue
+		}
+
+		value.WriteString(l.input[l.position:l.readPosition])
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+	}
+	l.readChar()
+
+	if len(escapeErrors) > 0 {
+		l.errors = append(l.errors, escapeErrors...)
+		return l.tokenFrom(token.ILLEGAL, pos)
+	}
+
+	return token.Token{Type: token.STRING, Literal: value.String(), Pos: pos, End: l.currentPosition()}
+}
+
+// readEscape decodes the escape sequence starting at the current backslash
+// into value. It returns a diagnostic, without recording it, if the sequence
+// is invalid.
+func (l *Lexer) readEscape(value *strings.Builder) *diagnostic.Diagnostic {
+	start := l.currentPosition()
+	l.readChar()
+
+	invalid := func(format string, a ...interface{}) *diagnostic.Diagnostic {
+		tok := l.tokenFrom(token.ILLEGAL, start)
+		return diagnostic.New(diagnostic.InvalidEscape, tok, format, a...)
+	}
+
+	switch l.ch {
+	case 'n':
+		value.WriteByte('\n')
+	case 't':
+		value.WriteByte('\t')
+	case 'r':
+		value.WriteByte('\r')
+	case '\\', '"':
+		value.WriteRune(l.ch)
+	case 'x':
+		l.readChar()
+		digits := l.readHexDigits(2)
+		if len(digits) != 2 {
+			return invalid("\\x must be followed by two hex digits")
+		}
+		b, _ := strconv.ParseUint(digits, 16, 8)
+		value.WriteByte(byte(b))
+		return nil
+	case 'u':
+		l.readChar()
+		if l.ch != '{' {
+			return invalid("\\u must be followed by {hex digits}")
 		}
+		l.readChar()
+		digits := l.readHexDigits(6)
+		if len(digits) == 0 || l.ch != '}' {
+			return invalid("\\u{...} must contain one to six hex digits")
+		}
+		l.readChar()
+		r, _ := strconv.ParseUint(digits, 16, 32)
+		if !utf8.ValidRune(rune(r)) {
+			return invalid("\\u{%s} is not a valid code point", digits)
+		}
+		value.WriteRune(rune(r))
+		return nil
+	default:
+		if l.ch == 0 || l.ch == '\n' {
+			return invalid("unterminated escape sequence")
+		}
+		l.readChar()
+		return invalid("unknown escape sequence %q", l.input[start.Offset:l.position])
+	}
+
+	l.readChar()
+	return nil
+}
+
+// readHexDigits reads up to max hex digits.
+func (l *Lexer) readHexDigits(max int) string {
+	position := l.position
+	for l.position-position < max && isHexDigit(l.ch) {
+		l.readChar()
 	}
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// tokenFrom returns a token of type t covering the input from pos up to the
+// current char.
+func (l *Lexer) tokenFrom(t token.TokenType, pos token.Position) token.Token {
+	return token.Token{Type: t, Literal: l.input[pos.Offset:l.position], Pos: pos, End: l.currentPosition()}
+}
+
+// readNumber reads an integer or a float such as 3.14, .5 or 1e-9. The
+// fraction needs digits after the dot, so "5." is the integer 5 followed by
+// a dot. An exponent without digits, as in 1.5e, makes the number ILLEGAL.
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
+	tokenType := token.TokenType(token.INT)
+
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peekChar()
+		if next == '+' || next == '-' {
+			next = l.peekCharAt(1)
+		}
+
+		tokenType = token.FLOAT
+		if !isDigit(next) {
+			tokenType = token.ILLEGAL
+		}
+		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+
+	return l.input[position:l.position], tokenType
 }
 
 func (l *Lexer) skipWhitespace() {
@@ -140,14 +471,19 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
@@ -1,6 +1,7 @@
 package lexer
 
 import (
+	"monkey-language/diagnostic"
 	"monkey-language/token"
 	"testing"
 )
@@ -46,7 +47,7 @@ func TestNextToken(t *testing.T) {
 	};
 	
 	let result = add(five, ten);
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5;
 
 	if (5 < 10) {
@@ -169,3 +170,364 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x + "ab";`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+		expectedOffset int
+	}{
+		{token.LET, 1, 1, 0},
+		{token.IDENT, 1, 5, 4},
+		{token.ASSING, 1, 7, 6},
+		{token.INT, 1, 9, 8},
+		{token.SEMICOLON, 1, 10, 9},
+		{token.IDENT, 2, 3, 13},
+		{token.PLUS, 2, 5, 15},
+		{token.STRING, 2, 7, 17},
+		{token.SEMICOLON, 2, 11, 21},
+		{token.EOF, 2, 12, 22},
+	}
+
+	l := New(input, WithFilename("main.mk"))
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong, expected=%d:%d, got=%d:%d", i, tt.expectedLine, tt.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+
+		if tok.Pos.Offset != tt.expectedOffset {
+			t.Fatalf("tests[%d] - offset wrong, expected=%d, got=%d", i, tt.expectedOffset, tok.Pos.Offset)
+		}
+
+		if tok.Pos.Filename != "main.mk" {
+			t.Fatalf("tests[%d] - filename wrong, expected=%q, got=%q", i, "main.mk", tok.Pos.Filename)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+	let x = 5; // trailing comment
+	/* block
+	   comment */ x / 2;
+	/* outer /* nested */ still comment */ x`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSING, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong, expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Errorf("lexer had errors: %v", l.Errors())
+	}
+}
+
+func TestKeepComments(t *testing.T) {
+	input := `x // one
+	/* two */ y`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x"},
+		{token.COMMENT, "// one"},
+		{token.COMMENT, "/* two */"},
+		{token.IDENT, "y"},
+		{token.EOF, ""},
+	}
+
+	l := New(input, WithComments())
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong, expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	input := "x /* never /* closed */"
+
+	l := New(input)
+	l.NextToken()
+	tok := l.NextToken()
+
+	if tok.Type != token.ILLEGAL {
+		t.Fatalf("tokenType wrong, expected=%q, got=%q", token.ILLEGAL, tok.Type)
+	}
+
+	if len(l.Errors()) != 1 {
+		t.Fatalf("wrong number of errors, expected=1, got=%d", len(l.Errors()))
+	}
+
+	d := l.Errors()[0]
+	if d.Code != diagnostic.UnterminatedComment {
+		t.Errorf("d.Code wrong, expected=%s, got=%s", diagnostic.UnterminatedComment, d.Code)
+	}
+
+	if d.Span.Start.Column != 3 {
+		t.Errorf("d.Span.Start.Column wrong, expected=3, got=%d", d.Span.Start.Column)
+	}
+
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Errorf("expected EOF after unterminated comment, got=%q", tok.Type)
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{"5", token.INT, "5"},
+		{"3.14", token.FLOAT, "3.14"},
+		{".5", token.FLOAT, ".5"},
+		{"1e-9", token.FLOAT, "1e-9"},
+		{"2E+10", token.FLOAT, "2E+10"},
+		{"1.5e3", token.FLOAT, "1.5e3"},
+		{"5.", token.INT, "5"},
+		{"5e", token.ILLEGAL, "5e"},
+		{"1.5e", token.ILLEGAL, "1.5e"},
+		{"2E+", token.ILLEGAL, "2E+"},
+	}
+
+	for _, tt := range tests {
+		tok := New(tt.input).NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Errorf("%q - tokenType wrong, expected=%q, got=%q", tt.input, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("%q - literal wrong, expected=%q, got=%q", tt.input, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestExponentWithoutDigits(t *testing.T) {
+	l := New("x = 1.5e + 1")
+	l.NextToken()
+	l.NextToken()
+	tok := l.NextToken()
+
+	if tok.Type != token.ILLEGAL || tok.Literal != "1.5e" {
+		t.Fatalf("wrong token, expected=ILLEGAL %q, got=%s %q", "1.5e", tok.Type, tok.Literal)
+	}
+
+	if len(l.Errors()) != 1 {
+		t.Fatalf("wrong number of errors, expected=1, got=%d", len(l.Errors()))
+	}
+
+	d := l.Errors()[0]
+	if d.Code != diagnostic.InvalidExponent || d.Span.Start.Column != 5 || d.Span.End.Column != 9 {
+		t.Errorf("wrong diagnostic, got=%s at %d-%d", d.Code, d.Span.Start.Column, d.Span.End.Column)
+	}
+
+	if next := l.NextToken(); next.Type != token.PLUS {
+		t.Errorf("expected PLUS after the number, got=%q", next.Type)
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+	}{
+		{`"plain"`, "plain"},
+		{`"a\nb\tc"`, "a\nb\tc"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"back\\slash"`, `back\slash`},
+		{`"\x41\x7a"`, "Az"},
+		{`"\u{48}\u{e9}\u{1F600}"`, "H\u00e9\U0001F600"},
+		{"`raw \\n \"quoted\"`", `raw \n "quoted"`},
+		{"`two\nlines`", "two\nlines"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.STRING {
+			t.Errorf("%s - tokenType wrong, expected=%q, got=%q: %v", tt.input, token.STRING, tok.Type, l.Errors())
+			continue
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("%s - literal wrong, expected=%q, got=%q", tt.input, tt.expectedLiteral, tok.Literal)
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("%s - expected EOF after string, got=%q", tt.input, next.Type)
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedCode   diagnostic.Code
+		expectedColumn int
+	}{
+		{`x = "never closed`, diagnostic.UnterminatedString, 5},
+		{"x = \"ends at\nnewline\"", diagnostic.UnterminatedString, 5},
+		{"x = `never closed", diagnostic.UnterminatedString, 5},
+		{`x = "bad \q"`, diagnostic.InvalidEscape, 10},
+		{`x = "\x4"`, diagnostic.InvalidEscape, 6},
+		{`x = "\u{110000}"`, diagnostic.InvalidEscape, 6},
+		{`x = "\u{}"`, diagnostic.InvalidEscape, 6},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		l.NextToken()
+		l.NextToken()
+		tok := l.NextToken()
+
+		if tok.Type != token.ILLEGAL {
+			t.Errorf("%s - tokenType wrong, expected=%q, got=%q", tt.input, token.ILLEGAL, tok.Type)
+			continue
+		}
+
+		if len(l.Errors()) != 1 {
+			t.Errorf("%s - wrong number of errors, expected=1, got=%d", tt.input, len(l.Errors()))
+			continue
+		}
+
+		d := l.Errors()[0]
+		if d.Code != tt.expectedCode {
+			t.Errorf("%s - d.Code wrong, expected=%s, got=%s", tt.input, tt.expectedCode, d.Code)
+		}
+
+		if d.Span.Start.Column != tt.expectedColumn {
+			t.Errorf("%s - d.Span.Start.Column wrong, expected=%d, got=%d", tt.input, tt.expectedColumn, d.Span.Start.Column)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := `let größe = "日本語";
+π ≠`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1, 1},
+		{token.IDENT, "größe", 1, 5},
+		{token.ASSING, "=", 1, 11},
+		{token.STRING, "日本語", 1, 13},
+		{token.SEMICOLON, ";", 1, 18},
+		{token.IDENT, "π", 2, 1},
+		{token.ILLEGAL, "≠", 2, 3},
+		{token.EOF, "", 2, 4},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong, expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position wrong, expected=%d:%d, got=%s", i, tt.expectedLine, tt.expectedColumn, tok.Pos)
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	input := `<= >= < > % && || & | ^ ~ << >> += -= *= /= %= a.b 1.c`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LT_EQ, "<="},
+		{token.GT_EQ, ">="},
+		{token.LT, "<"},
+		{token.GT, ">"},
+		{token.PERCENT, "%"},
+		{token.AND, "&&"},
+		{token.OR, "||"},
+		{token.BIT_AND, "&"},
+		{token.BIT_OR, "|"},
+		{token.BIT_XOR, "^"},
+		{token.BIT_NOT, "~"},
+		{token.SHL, "<<"},
+		{token.SHR, ">>"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.MINUS_ASSIGN, "-="},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.SLASH_ASSIGN, "/="},
+		{token.PERCENT_ASSIGN, "%="},
+		{token.IDENT, "a"},
+		{token.DOT, "."},
+		{token.IDENT, "b"},
+		{token.INT, "1"},
+		{token.DOT, "."},
+		{token.IDENT, "c"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokenType wrong, expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong, expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
@@ -1,13 +1,23 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"monkey-language/repl"
 	"os"
 	"os/user"
 )
 
+var engine = flag.String("engine", repl.EngineEval, "use 'vm' or 'eval'")
+
 func main() {
+	flag.Parse()
+
+	if *engine != repl.EngineEval && *engine != repl.EngineVM {
+		fmt.Fprintf(os.Stderr, "unknown engine %q, use 'vm' or 'eval'\n", *engine)
+		os.Exit(2)
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -15,5 +25,5 @@ func main() {
 
 	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username)
 	fmt.Printf("Feel free to type in commands!\n")
-	repl.Start(os.Stdin, os.Stdout)
+	repl.Start(os.Stdin, os.Stdout, *engine)
 }
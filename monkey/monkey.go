@@ -0,0 +1,293 @@
+// Package monkey embeds the Monkey interpreter in Go programs.
+//
+//	in := monkey.New(monkey.WithStdout(&out))
+//	in.Set("limit", 10)
+//	result, err := in.Eval(ctx, "limit * 2")
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"monkey-language/diagnostic"
+	"monkey-language/evaluator"
+	"monkey-language/lexer"
+	"monkey-language/object"
+	"monkey-language/parser"
+	"monkey-language/token"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Interpreter evaluates Monkey source with the tree-walking evaluator. Globals
+// defined by one call to Eval are visible to the next. An Interpreter must not
+// be used from several goroutines at once.
+type Interpreter struct {
+	env      *object.Environment
+	stdout   io.Writer
+	stderr   io.Writer
+	evalOpts []evaluator.Option
+}
+
+type Option func(*Interpreter)
+
+// WithStdout sets where puts writes, os.Stdout by default.
+func WithStdout(w io.Writer) Option {
+	return func(in *Interpreter) {
+		in.stdout = w
+	}
+}
+
+// WithStderr sets where eputs writes, os.Stderr by default.
+func WithStderr(w io.Writer) Option {
+	return func(in *Interpreter) {
+		in.stderr = w
+	}
+}
+
+// WithStepLimit stops every call to Eval after n evaluation steps, roughly
+// one per expression or statement evaluated.
+func WithStepLimit(n int) Option {
+	return func(in *Interpreter) {
+		in.evalOpts = append(in.evalOpts, evaluator.WithStepLimit(n))
+	}
+}
+
+// WithMaxDepth sets how deeply function calls may nest, by default
+// evaluator.DefaultMaxDepth.
+func WithMaxDepth(n int) Option {
+	return func(in *Interpreter) {
+		in.evalOpts = append(in.evalOpts, evaluator.WithMaxDepth(n))
+	}
+}
+
+// WithMemoryLimit stops every call to Eval once the strings, arrays, hashes
+// and big integers it creates take more than about n bytes.
+func WithMemoryLimit(n int) Option {
+	return func(in *Interpreter) {
+		in.evalOpts = append(in.evalOpts, evaluator.WithMemoryLimit(n))
+	}
+}
+
+// WithOverflow sets what integer arithmetic does when a result does not fit
+// in an int64, by default object.OverflowPromote.
+func WithOverflow(o object.Overflow) Option {
+	return func(in *Interpreter) {
+		in.evalOpts = append(in.evalOpts, evaluator.WithOverflow(o))
+	}
+}
+
+func New(opts ...Option) *Interpreter {
+	in := &Interpreter{
+		env:    object.NewEnvironment(),
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}
+	for _, opt := range opts {
+		opt(in)
+	}
+
+	in.env.Set("puts", object.Puts(in.stdout))
+	in.env.Set("eputs", object.Puts(in.stderr))
+	return in
+}
+
+// Eval evaluates src and returns the value of its last statement, or NULL if
+// it has none. Syntax errors are returned as *SyntaxError and runtime errors
+// as *RuntimeError, including the one stopping evaluation when ctx is done
+// or a limit is reached.
+func (in *Interpreter) Eval(ctx context.Context, src string) (object.Object, error) {
+	return in.eval(ctx, src)
+}
+
+// EvalFile is like Eval, evaluating the contents of the named file. Positions
+// in errors carry the filename.
+func (in *Interpreter) EvalFile(ctx context.Context, filename string) (object.Object, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return in.eval(ctx, string(src), lexer.WithFilename(filename))
+}
+
+func (in *Interpreter) eval(ctx context.Context, src string, opts ...lexer.Option) (object.Object, error) {
+	p := parser.New(lexer.New(src, opts...))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &SyntaxError{Diagnostics: p.Errors()}
+	}
+
+	result := evaluator.EvalContext(ctx, program, in.env, in.evalOpts...)
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Kind: errObj.Kind, Message: errObj.Message, Pos: errObj.Pos, Stack: errObj.Stack, Value: errObj.Value}
+	}
+	if result == nil {
+		return evaluator.NULL, nil
+	}
+	return result, nil
+}
+
+// Get returns the value of the global name.
+func (in *Interpreter) Get(name string) (object.Object, bool) {
+	return in.env.Get(name)
+}
+
+// Set binds the global name to value, converted with ToObject. It replaces
+// any binding of name, including a constant one.
+func (in *Interpreter) Set(name string, value interface{}) error {
+	obj, err := ToObject(value)
+	if err != nil {
+		return err
+	}
+	in.env.Set(name, obj)
+	return nil
+}
+
+// Func is a Go function callable from Monkey. A non-nil error is raised as a
+// runtime error at the call site.
+type Func func(args ...object.Object) (object.Object, error)
+
+// Register makes fn callable from Monkey as name, taking precedence over a
+// builtin of the same name.
+func (in *Interpreter) Register(name string, fn Func) {
+	in.env.Set(name, fn.builtin())
+}
+
+// RegisterMethod makes fn a method called name of the values of type t, so
+// that value.name(args) calls fn with value followed by args. Unlike Register
+// it affects every Interpreter, and it takes precedence over a method of the
+// same name, such as the builtin methods of arrays, strings and hashes.
+func RegisterMethod(t object.ObjectType, name string, fn Func) {
+	object.RegisterMethod(t, name, fn.builtin())
+}
+
+func (fn Func) builtin() *object.Builtin {
+	return &object.Builtin{Fn: func(rt object.Runtime, args ...object.Object) object.Object {
+		result, err := fn(args...)
+		if err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		return result
+	}}
+}
+
+// ToObject converts a Go value to a Monkey object. It accepts nil, booleans,
+// integers, including *big.Int, floats, strings, []interface{},
+// map[string]interface{}, whose keys are inserted in sorted order, and values
+// that already are objects.
+func ToObject(value interface{}) (object.Object, error) {
+	switch value := value.(type) {
+	case nil:
+		return evaluator.NULL, nil
+	case object.Object:
+		return value, nil
+	case bool:
+		if value {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case int:
+		return &object.Integer{Value: int64(value)}, nil
+	case int8:
+		return &object.Integer{Value: int64(value)}, nil
+	case int16:
+		return &object.Integer{Value: int64(value)}, nil
+	case int32:
+		return &object.Integer{Value: int64(value)}, nil
+	case int64:
+		return &object.Integer{Value: value}, nil
+	case uint8:
+		return &object.Integer{Value: int64(value)}, nil
+	case uint16:
+		return &object.Integer{Value: int64(value)}, nil
+	case uint32:
+		return &object.Integer{Value: int64(value)}, nil
+	case uint64:
+		return ToObject(new(big.Int).SetUint64(value))
+	case *big.Int:
+		if value.IsInt64() {
+			return &object.Integer{Value: value.Int64()}, nil
+		}
+		return &object.BigInteger{Value: new(big.Int).Set(value)}, nil
+	case float32:
+		return &object.Float{Value: float64(value)}, nil
+	case float64:
+		return &object.Float{Value: value}, nil
+	case string:
+		return &object.String{Value: value}, nil
+	case []interface{}:
+		elements := make([]object.Object, len(value))
+		for i, v := range value {
+			el, err := ToObject(v)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		pairs := make([]object.HashPair, 0, len(value))
+		for _, k := range keys {
+			v, err := ToObject(value[k])
+			if err != nil {
+				return nil, err
+			}
+			key := &object.String{Value: k}
+			pairs = append(pairs, object.HashPair{Key: key, Value: v})
+		}
+		return object.NewHash(pairs...), nil
+	default:
+		return nil, fmt.Errorf("monkey: cannot convert %T to an object", value)
+	}
+}
+
+// SyntaxError reports the problems found while parsing a program.
+type SyntaxError struct {
+	Diagnostics []*diagnostic.Diagnostic
+}
+
+func (e *SyntaxError) Error() string {
+	messages := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		messages[i] = d.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// RuntimeError reports an error raised while evaluating a program. Kind is
+// set when evaluation stopped because ctx was done or a limit was reached.
+type RuntimeError struct {
+	Kind    object.ErrorKind
+	Message string
+	Pos     token.Position // where the error occurred, if known
+	Stack   []object.Frame // the calls the error was raised in, innermost first
+	Value   object.Object  // the value thrown by a throw statement, if any
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Message
+	}
+	return e.Message
+}
+
+// Unwrap returns context.Canceled or context.DeadlineExceeded if evaluation
+// was stopped by its context.
+func (e *RuntimeError) Unwrap() error {
+	switch e.Kind {
+	case object.CANCELLED_ERR:
+		return context.Canceled
+	case object.TIMEOUT_ERR:
+		return context.DeadlineExceeded
+	default:
+		return nil
+	}
+}
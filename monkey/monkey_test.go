@@ -0,0 +1,298 @@
+package monkey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"monkey-language/object"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", "3"},
+		{`"a" + "b"`, "ab"},
+		{"let x = 1;", "null"},
+		{"", "null"},
+		{"[1, 2.5, true]", "[1, 2.5, true]"},
+	}
+
+	for _, tt := range tests {
+		result, err := New().Eval(context.Background(), tt.input)
+		if err != nil {
+			t.Errorf("Eval(%q) returned error: %s", tt.input, err)
+			continue
+		}
+
+		if result.Inspect() != tt.expected {
+			t.Errorf("Eval(%q) wrong result, expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestGlobalsPersistAcrossEvals(t *testing.T) {
+	in := New()
+	ctx := context.Background()
+
+	if _, err := in.Eval(ctx, "let add = fn(a, b) { a + b }; let x = 2;"); err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+
+	result, err := in.Eval(ctx, "add(x, 3)")
+	if err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+
+	if result.Inspect() != "5" {
+		t.Errorf("wrong result, got=%q", result.Inspect())
+	}
+}
+
+func TestSetAndGet(t *testing.T) {
+	in := New()
+	ctx := context.Background()
+
+	values := map[string]interface{}{
+		"n":    10,
+		"f":    1.5,
+		"s":    "hi",
+		"b":    true,
+		"none": nil,
+		"arr":  []interface{}{1, "two"},
+		"h":    map[string]interface{}{"k": int64(3)},
+		"obj":  &object.Integer{Value: 4},
+	}
+	for name, value := range values {
+		if err := in.Set(name, value); err != nil {
+			t.Fatalf("Set(%q) returned error: %s", name, err)
+		}
+	}
+
+	result, err := in.Eval(ctx, `let total = n + f + h["k"] + obj + len(arr); [s, b, none, total]`)
+	if err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+
+	if result.Inspect() != "[hi, true, null, 20.5]" {
+		t.Errorf("wrong result, got=%q", result.Inspect())
+	}
+
+	total, ok := in.Get("total")
+	if !ok {
+		t.Fatalf("Get(%q) found nothing", "total")
+	}
+	if total.Inspect() != "20.5" {
+		t.Errorf("wrong total, got=%q", total.Inspect())
+	}
+
+	if _, ok := in.Get("missing"); ok {
+		t.Errorf("Get(%q) found a value", "missing")
+	}
+
+	if err := in.Set("c", make(chan int)); err == nil {
+		t.Errorf("Set with a channel returned no error")
+	}
+}
+
+func TestIntegers(t *testing.T) {
+	in := New()
+	if err := in.Set("big", new(big.Int).Lsh(big.NewInt(1), 64)); err != nil {
+		t.Fatalf("Set returned error: %s", err)
+	}
+	if err := in.Set("max", uint64(math.MaxUint64)); err != nil {
+		t.Fatalf("Set returned error: %s", err)
+	}
+
+	result, err := in.Eval(context.Background(), "[big - max, big * 2]")
+	if err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+	if result.Inspect() != "[1, 36893488147419103232]" {
+		t.Errorf("wrong result, got=%q", result.Inspect())
+	}
+
+	_, err = New(WithOverflow(object.OverflowError)).Eval(context.Background(), "9223372036854775807 + 1")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Kind != object.OVERFLOW_ERR {
+		t.Errorf("expected overflow error, got=%v", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	in := New()
+	in.Register("double", func(args ...object.Object) (object.Object, error) {
+		n, ok := args[0].(*object.Integer)
+		if !ok {
+			return nil, fmt.Errorf("double: want INTEGER, got %s", args[0].Type())
+		}
+		return &object.Integer{Value: n.Value * 2}, nil
+	})
+
+	result, err := in.Eval(context.Background(), "double(21)")
+	if err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+	if result.Inspect() != "42" {
+		t.Errorf("wrong result, got=%q", result.Inspect())
+	}
+
+	_, err = in.Eval(context.Background(), `double("x")`)
+	if err == nil || err.Error() != "1:7: double: want INTEGER, got STRING" {
+		t.Errorf("wrong error, got=%v", err)
+	}
+}
+
+type point struct{ x, y int64 }
+
+func (p *point) Type() object.ObjectType { return "POINT" }
+func (p *point) Inspect() string         { return fmt.Sprintf("(%d, %d)", p.x, p.y) }
+
+func TestRegisterMethod(t *testing.T) {
+	RegisterMethod("POINT", "sum", func(args ...object.Object) (object.Object, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("sum: want no arguments, got %d", len(args)-1)
+		}
+		p := args[0].(*point)
+		return &object.Integer{Value: p.x + p.y}, nil
+	})
+
+	in := New()
+	if err := in.Set("p", &point{x: 1, y: 2}); err != nil {
+		t.Fatalf("Set returned error: %s", err)
+	}
+
+	result, err := in.Eval(context.Background(), "[p.sum(), [1, 2].map(fn(x) { x * p.sum() }).len()]")
+	if err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+	if result.Inspect() != "[3, 2]" {
+		t.Errorf("wrong result, got=%q", result.Inspect())
+	}
+
+	_, err = in.Eval(context.Background(), "p.sum(1)")
+	if err == nil || err.Error() != "1:6: sum: want no arguments, got 1" {
+		t.Errorf("wrong error, got=%v", err)
+	}
+
+	_, err = in.Eval(context.Background(), "p.x")
+	if err == nil || err.Error() != "1:2: unknown method: POINT.x" {
+		t.Errorf("wrong error, got=%v", err)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	in := New(WithStdout(&stdout), WithStderr(&stderr))
+
+	if _, err := in.Eval(context.Background(), `puts("out", 1); eputs("err")`); err != nil {
+		t.Fatalf("Eval returned error: %s", err)
+	}
+
+	if stdout.String() != "out\n1\n" {
+		t.Errorf("wrong stdout, got=%q", stdout.String())
+	}
+	if stderr.String() != "err\n" {
+		t.Errorf("wrong stderr, got=%q", stderr.String())
+	}
+}
+
+func TestErrors(t *testing.T) {
+	in := New()
+	ctx := context.Background()
+
+	_, err := in.Eval(ctx, "let x 1;")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("expected *SyntaxError, got=%T (%v)", err, err)
+	}
+	if err.Error() != "1:7: expected next token to be =, got INT instead" {
+		t.Errorf("wrong syntax error, got=%q", err.Error())
+	}
+
+	_, err = in.Eval(ctx, "1 + true")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected *RuntimeError, got=%T (%v)", err, err)
+	}
+	if runtimeErr.Message != "unknown operator: INTEGER + BOOLEAN" || runtimeErr.Pos.String() != "1:3" {
+		t.Errorf("wrong runtime error, got=%q", err.Error())
+	}
+
+	_, err = in.Eval(ctx, "let check = fn(x) { x + true };\ncheck(1)")
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected *RuntimeError, got=%T (%v)", err, err)
+	}
+	if len(runtimeErr.Stack) != 1 || runtimeErr.Stack[0].Function != "check" || runtimeErr.Stack[0].Pos.String() != "2:6" {
+		t.Errorf("wrong stack, got=%+v", runtimeErr.Stack)
+	}
+
+	_, err = in.Eval(ctx, `throw {"message": "bad"}`)
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected *RuntimeError, got=%T (%v)", err, err)
+	}
+	if err.Error() != "1:1: bad" || runtimeErr.Value == nil || runtimeErr.Value.Type() != object.HASH_OBJ {
+		t.Errorf("wrong thrown error, got=%q, value=%v", err.Error(), runtimeErr.Value)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := in.Eval(cancelled, "1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got=%v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	in := New(WithStepLimit(1000), WithMaxDepth(10), WithMemoryLimit(1000))
+
+	_, err := in.Eval(context.Background(), "let f = fn() { f() }; f()")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Kind != object.STACK_OVERFLOW_ERR {
+		t.Errorf("expected stack overflow, got=%v", err)
+	}
+
+	_, err = in.Eval(context.Background(), "while (true) {}")
+	if !errors.As(err, &runtimeErr) || runtimeErr.Kind != object.STEP_LIMIT_ERR {
+		t.Errorf("expected step limit error, got=%v", err)
+	}
+
+	_, err = in.Eval(context.Background(), `let s = "0123456789"; for (i in [1, 2, 3, 4, 5, 6, 7]) { s = s + s }`)
+	if !errors.As(err, &runtimeErr) || runtimeErr.Kind != object.MEMORY_LIMIT_ERR {
+		t.Errorf("expected memory limit error, got=%v", err)
+	}
+
+	_, err = New(WithMemoryLimit(1000)).Eval(context.Background(), "range(1000000)")
+	if !errors.As(err, &runtimeErr) || runtimeErr.Kind != object.MEMORY_LIMIT_ERR {
+		t.Errorf("expected memory limit error, got=%v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := New().Eval(ctx, "while (true) {}"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got=%v", err)
+	}
+}
+
+func TestEvalFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.mk")
+	if err := os.WriteFile(filename, []byte("let x = 1;\nx + true"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := New().EvalFile(context.Background(), filename)
+	if err == nil || err.Error() != filename+":2:3: unknown operator: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error, got=%v", err)
+	}
+
+	if _, err := New().EvalFile(context.Background(), filename+".missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected os.ErrNotExist, got=%v", err)
+	}
+}
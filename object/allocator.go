@@ -0,0 +1,94 @@
+package object
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Approximate sizes, in bytes, used to account for allocations.
+const (
+	objectSize  = 16 // an object header and the interface value pointing to it
+	elementSize = 16 // an array element
+	pairSize    = 64 // a hash key, its pair and the map entry holding them
+	wordSize    = 8  // a word of a big integer
+)
+
+// Allocator keeps an approximate count of the bytes taken by the strings,
+// arrays, hashes and big integers created during an evaluation, and fails allocations once
+// the count exceeds its limit. A nil *Allocator counts nothing.
+type Allocator struct {
+	limit     int
+	allocated int
+}
+
+// NewAllocator returns an Allocator allowing limit bytes to be allocated, or
+// any number of them if limit is zero.
+func NewAllocator(limit int) *Allocator {
+	return &Allocator{limit: limit}
+}
+
+// Allocated returns the number of bytes allocated so far.
+func (a *Allocator) Allocated() int {
+	if a == nil {
+		return 0
+	}
+	return a.allocated
+}
+
+// Alloc records size more bytes, returning a MEMORY_LIMIT error if that
+// exceeds the limit. Once exceeded, every later allocation fails too.
+func (a *Allocator) Alloc(size int) *Error {
+	if a == nil {
+		return nil
+	}
+
+	a.allocated += size
+	if a.limit > 0 && a.allocated > a.limit {
+		return &Error{
+			Kind:    MEMORY_LIMIT_ERR,
+			Message: fmt.Sprintf("memory limit of %d bytes exceeded", a.limit),
+		}
+	}
+	return nil
+}
+
+func (a *Allocator) NewString(value string) Object {
+	if err := a.Alloc(objectSize + len(value)); err != nil {
+		return err
+	}
+	return &String{Value: value}
+}
+
+func (a *Allocator) NewArray(elements []Object) Object {
+	if err := a.Alloc(objectSize + elementSize*len(elements)); err != nil {
+		return err
+	}
+	return &Array{Elements: elements}
+}
+
+func (a *Allocator) NewHash(pairs []HashPair) Object {
+	h := NewHash(pairs...)
+	if err := a.Alloc(objectSize + pairSize*h.Len()); err != nil {
+		return err
+	}
+	return h
+}
+
+func (a *Allocator) NewBigInteger(value *big.Int) Object {
+	if err := a.Alloc(objectSize + wordSize*len(value.Bits())); err != nil {
+		return err
+	}
+	return &BigInteger{Value: value}
+}
+
+// SetPair stores pair in h under key, counting the pair if key is new, and
+// returns the value of the pair.
+func (a *Allocator) SetPair(h *Hash, key HashKey, pair HashPair) Object {
+	if _, ok := h.Get(key); !ok {
+		if err := a.Alloc(pairSize); err != nil {
+			return err
+		}
+	}
+	h.Set(key, pair)
+	return pair.Value
+}
@@ -0,0 +1,211 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Overflow says what integer arithmetic does with a result that does not fit
+// in an int64.
+type Overflow int
+
+const (
+	OverflowPromote Overflow = iota // make it a *BigInteger, the default
+	OverflowWrap                    // wrap around, as Go does
+	OverflowError                   // fail with an OVERFLOW error
+)
+
+// maxShift is the largest count << shifts a big integer by, so that a single
+// shift cannot take unbounded memory.
+const maxShift = 1 << 20
+
+// IntegerArithmetic applies op, one of + - * / % & | ^ << and >>, to left and
+// right, which are *Integer or *BigInteger, following the Overflow policy of
+// rt. Dividing by zero is an error whatever the policy.
+func IntegerArithmetic(rt Runtime, op string, left, right Object) Object {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		result, exact, err := int64Arithmetic(op, l.Value, r.Value)
+		if err != nil {
+			return err
+		}
+		if exact || rt.Overflow() == OverflowWrap {
+			return &Integer{Value: result}
+		}
+	}
+
+	result, err := bigArithmetic(op, toBig(left), toBig(right))
+	if err != nil {
+		return err
+	}
+	return fitInteger(rt, result, left.Inspect()+" "+op+" "+right.Inspect())
+}
+
+// IntegerPrefix applies the prefix operator op, - or ~, to operand, an
+// *Integer or *BigInteger.
+func IntegerPrefix(rt Runtime, op string, operand Object) Object {
+	if i, ok := operand.(*Integer); ok {
+		switch {
+		case op == "~":
+			return &Integer{Value: ^i.Value}
+		case op == "-" && (i.Value != math.MinInt64 || rt.Overflow() == OverflowWrap):
+			return &Integer{Value: -i.Value}
+		}
+	}
+
+	switch op {
+	case "-":
+		return fitInteger(rt, new(big.Int).Neg(toBig(operand)), "-("+operand.Inspect()+")")
+	case "~":
+		return fitInteger(rt, new(big.Int).Not(toBig(operand)), "~"+operand.Inspect())
+	default:
+		return &Error{Message: fmt.Sprintf("unknown operator: %s%s", op, INTEGER_OBJ)}
+	}
+}
+
+// CompareIntegers returns -1, 0 or +1 as left, an *Integer or *BigInteger,
+// is less than, equal to or greater than right.
+func CompareIntegers(left, right Object) int {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		switch {
+		case l.Value < r.Value:
+			return -1
+		case l.Value > r.Value:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return toBig(left).Cmp(toBig(right))
+}
+
+// int64Arithmetic is IntegerArithmetic on int64s, reporting whether result is
+// exact or wrapped around.
+func int64Arithmetic(op string, left, right int64) (result int64, exact bool, err *Error) {
+	switch op {
+	case "+":
+		result = left + right
+		return result, (left^result)&(right^result) >= 0, nil
+	case "-":
+		result = left - right
+		return result, (left^right)&(left^result) >= 0, nil
+	case "*":
+		result = left * right
+		return result, left == 0 || result/left == right && !(left == -1 && right == math.MinInt64), nil
+	case "/", "%":
+		if right == 0 {
+			return 0, false, divisionByZero()
+		}
+		if op == "%" {
+			return left % right, true, nil
+		}
+		return left / right, !(left == math.MinInt64 && right == -1), nil
+	case "&":
+		return left & right, true, nil
+	case "|":
+		return left | right, true, nil
+	case "^":
+		return left ^ right, true, nil
+	case "<<", ">>":
+		if right < 0 {
+			return 0, false, &Error{Message: fmt.Sprintf("negative shift count: %d", right)}
+		}
+		if op == ">>" {
+			return left >> right, true, nil
+		}
+		result = left << right
+		return result, result>>right == left, nil
+	default:
+		return 0, false, unknownOperator(op)
+	}
+}
+
+func bigArithmetic(op string, left, right *big.Int) (*big.Int, *Error) {
+	result := new(big.Int)
+
+	switch op {
+	case "+":
+		return result.Add(left, right), nil
+	case "-":
+		return result.Sub(left, right), nil
+	case "*":
+		return result.Mul(left, right), nil
+	case "/", "%":
+		if right.Sign() == 0 {
+			return nil, divisionByZero()
+		}
+		if op == "%" {
+			return result.Rem(left, right), nil
+		}
+		return result.Quo(left, right), nil
+	case "&":
+		return result.And(left, right), nil
+	case "|":
+		return result.Or(left, right), nil
+	case "^":
+		return result.Xor(left, right), nil
+	case "<<", ">>":
+		if right.Sign() < 0 {
+			return nil, &Error{Message: "negative shift count: " + right.String()}
+		}
+		if op == ">>" {
+			// Shifting by more than the bit length leaves 0 or -1.
+			if !right.IsInt64() || right.Int64() > int64(left.BitLen()) {
+				return result.Rsh(left, uint(left.BitLen()+1)), nil
+			}
+			return result.Rsh(left, uint(right.Int64())), nil
+		}
+		if left.Sign() == 0 {
+			return result, nil
+		}
+		if !right.IsInt64() || right.Int64() > maxShift {
+			return nil, &Error{Kind: OVERFLOW_ERR, Message: fmt.Sprintf("shift count too large: %s", right)}
+		}
+		return result.Lsh(left, uint(right.Int64())), nil
+	default:
+		return nil, unknownOperator(op)
+	}
+}
+
+// fitInteger returns value as an *Integer if it fits in an int64, and
+// otherwise follows the Overflow policy of rt. expr describes the operation
+// that overflowed.
+func fitInteger(rt Runtime, value *big.Int, expr string) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+
+	switch rt.Overflow() {
+	case OverflowWrap:
+		return &Integer{Value: int64(new(big.Int).And(value, maxUint64).Uint64())}
+	case OverflowError:
+		return &Error{Kind: OVERFLOW_ERR, Message: "integer overflow: " + expr}
+	default:
+		return rt.Allocator().NewBigInteger(value)
+	}
+}
+
+var maxUint64 = new(big.Int).SetUint64(math.MaxUint64)
+
+func toBig(obj Object) *big.Int {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value)
+	case *BigInteger:
+		return obj.Value
+	default:
+		return new(big.Int)
+	}
+}
+
+func divisionByZero() *Error {
+	return &Error{Kind: DIVISION_BY_ZERO_ERR, Message: "division by zero"}
+}
+
+func unknownOperator(op string) *Error {
+	return &Error{Message: fmt.Sprintf("unknown operator: %s %s %s", INTEGER_OBJ, op, INTEGER_OBJ)}
+}
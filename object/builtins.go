@@ -0,0 +1,209 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// Builtins is shared by the evaluator and the compiler, which refers to
+// builtins by their index, so new entries must only be appended.
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{"len", &Builtin{Fn: func(rt Runtime, args ...Object) Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		switch args := args[0].(type) {
+		case *String:
+			return &Integer{Value: int64(utf8.RuneCountInString(args.Value))}
+		case *Array:
+			return &Integer{Value: int64(len(args.Elements))}
+		case *Hash:
+			return &Integer{Value: int64(args.Len())}
+		default:
+			return newError("argument to `len` not supported, got=%s", args.Type())
+		}
+	},
+	}},
+	{"first", &Builtin{Fn: func(rt Runtime, args ...Object) Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+
+		if args[0].Type() != ARRAY_OBJ {
+			return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
+		}
+
+		arr := args[0].(*Array)
+		if len(arr.Elements) > 0 {
+			return arr.Elements[0]
+		}
+
+		return nil
+	},
+	}},
+	{"last", &Builtin{Fn: func(rt Runtime, args ...Object) Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+
+		if args[0].Type() != ARRAY_OBJ {
+			return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
+		}
+
+		arr := args[0].(*Array)
+		length := len(arr.Elements)
+		if length > 0 {
+			return arr.Elements[length-1]
+		}
+
+		return nil
+	},
+	}},
+	{"rest", &Builtin{Fn: func(rt Runtime, args ...Object) Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+
+		if args[0].Type() != ARRAY_OBJ {
+			return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
+		}
+
+		arr := args[0].(*Array)
+		length := len(arr.Elements)
+		if length > 0 {
+			newElements := make([]Object, length-1)
+			copy(newElements, arr.Elements[1:length])
+			return rt.Allocator().NewArray(newElements)
+		}
+
+		return nil
+	},
+	}},
+	{"push", &Builtin{Fn: func(rt Runtime, args ...Object) Object {
+		if len(args) != 2 {
+			return newError("wrong number of arguments. got=%d, want=2", len(args))
+		}
+
+		if args[0].Type() != ARRAY_OBJ {
+			return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+		}
+
+		arr := args[0].(*Array)
+		length := len(arr.Elements)
+
+		newElements := make([]Object, length+1)
+		copy(newElements, arr.Elements)
+		newElements[length] = args[1]
+
+		return rt.Allocator().NewArray(newElements)
+	},
+	}},
+	{"puts", Puts(os.Stdout)},
+	{"bytes", &Builtin{Fn: func(rt Runtime, args ...Object) Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+
+		if args[0].Type() != STRING_OBJ {
+			return newError("argument to `bytes` must be STRING, got %s", args[0].Type())
+		}
+
+		str := args[0].(*String).Value
+		elements := make([]Object, len(str))
+		for i := 0; i < len(str); i++ {
+			elements[i] = &Integer{Value: int64(str[i])}
+		}
+
+		return rt.Allocator().NewArray(elements)
+	},
+	}},
+	{"chars", &Builtin{Fn: func(rt Runtime, args ...Object) Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+
+		if args[0].Type() != STRING_OBJ {
+			return newError("argument to `chars` must be STRING, got %s", args[0].Type())
+		}
+
+		elements := []Object{}
+		for _, ch := range args[0].(*String).Value {
+			elements = append(elements, &Char{Value: ch})
+		}
+
+		return rt.Allocator().NewArray(elements)
+	},
+	}},
+	{"eputs", Puts(os.Stderr)},
+	{"is", &Builtin{Fn: func(rt Runtime, args ...Object) Object {
+		if len(args) != 2 {
+			return newError("wrong number of arguments. got=%d, want=2", len(args))
+		}
+
+		if Identical(args[0], args[1]) {
+			return TRUE
+		}
+		return FALSE
+	},
+	}},
+	{"map", &Builtin{Fn: builtinMap}},
+	{"filter", &Builtin{Fn: builtinFilter}},
+	{"reduce", &Builtin{Fn: builtinReduce}},
+	{"sort", &Builtin{Fn: builtinSort}},
+	{"zip", &Builtin{Fn: builtinZip}},
+	{"any", &Builtin{Fn: builtinAny}},
+	{"all", &Builtin{Fn: builtinAll}},
+	{"find", &Builtin{Fn: builtinFind}},
+	{"range", &Builtin{Fn: builtinRange}},
+	{"reverse", &Builtin{Fn: builtinReverse}},
+	{"split", &Builtin{Fn: builtinSplit}},
+	{"join", &Builtin{Fn: builtinJoin}},
+	{"trim", &Builtin{Fn: builtinTrim}},
+	{"upper", &Builtin{Fn: builtinUpper}},
+	{"lower", &Builtin{Fn: builtinLower}},
+	{"contains", &Builtin{Fn: builtinContains}},
+	{"index_of", &Builtin{Fn: builtinIndexOf}},
+	{"replace", &Builtin{Fn: builtinReplace}},
+	{"starts_with", &Builtin{Fn: builtinStartsWith}},
+	{"ends_with", &Builtin{Fn: builtinEndsWith}},
+	{"repeat", &Builtin{Fn: builtinRepeat}},
+	{"substr", &Builtin{Fn: builtinSubstr}},
+	{"format", &Builtin{Fn: builtinFormat}},
+	{"to_int", &Builtin{Fn: builtinToInt}},
+	{"to_string", &Builtin{Fn: builtinToString}},
+	{"keys", &Builtin{Fn: builtinKeys}},
+	{"values", &Builtin{Fn: builtinValues}},
+	{"entries", &Builtin{Fn: builtinEntries}},
+	{"has", &Builtin{Fn: builtinHas}},
+	{"delete", &Builtin{Fn: builtinDelete}},
+	{"merge", &Builtin{Fn: builtinMerge}},
+}
+
+// Puts returns a builtin that writes each of its arguments to w on a line
+// of its own.
+func Puts(w io.Writer) *Builtin {
+	return &Builtin{Fn: func(rt Runtime, args ...Object) Object {
+		for _, arg := range args {
+			fmt.Fprintln(w, arg.Inspect())
+		}
+		return nil
+	}}
+}
+
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
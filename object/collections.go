@@ -0,0 +1,325 @@
+package object
+
+import (
+	"sort"
+	"strings"
+)
+
+// The builtins working on collections. Those taking a function call it
+// through their Runtime and return the first error it raises.
+
+func builtinMap(rt Runtime, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	values, ok := Iterate(args[0])
+	if !ok {
+		return notIterableError("map", args[0])
+	}
+
+	elements := make([]Object, len(values))
+	for i, value := range values {
+		result := rt.Call(args[1], value)
+		if isError(result) {
+			return result
+		}
+		elements[i] = result
+	}
+
+	return rt.Allocator().NewArray(elements)
+}
+
+func builtinFilter(rt Runtime, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	values, ok := Iterate(args[0])
+	if !ok {
+		return notIterableError("filter", args[0])
+	}
+
+	elements := []Object{}
+	for _, value := range values {
+		result := rt.Call(args[1], value)
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			elements = append(elements, value)
+		}
+	}
+
+	return rt.Allocator().NewArray(elements)
+}
+
+// builtinReduce folds the values with fn(accumulator, value), starting from
+// the initial value if one is given and from the first value otherwise.
+func builtinReduce(rt Runtime, args ...Object) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+	}
+
+	values, ok := Iterate(args[0])
+	if !ok {
+		return notIterableError("reduce", args[0])
+	}
+
+	var acc Object
+	if len(args) == 3 {
+		acc = args[2]
+	} else if len(values) > 0 {
+		acc, values = values[0], values[1:]
+	} else {
+		return newError("`reduce` of an empty collection without an initial value")
+	}
+
+	for _, value := range values {
+		acc = rt.Call(args[1], acc, value)
+		if isError(acc) {
+			return acc
+		}
+	}
+
+	return acc
+}
+
+// builtinSort returns a sorted copy of an array. Without a function numbers,
+// strings and chars are sorted in ascending order; with one, a goes before b
+// when fn(a, b) is truthy. The sort is stable.
+func builtinSort(rt Runtime, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	if args[0].Type() != ARRAY_OBJ {
+		return newError("argument to `sort` must be ARRAY, got %s", args[0].Type())
+	}
+
+	elements := make([]Object, len(args[0].(*Array).Elements))
+	copy(elements, args[0].(*Array).Elements)
+
+	var err Object
+	sort.SliceStable(elements, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+
+		if len(args) == 1 {
+			c, cerr := compare(elements[i], elements[j])
+			if cerr != nil {
+				err = cerr
+			}
+			return c < 0
+		}
+
+		result := rt.Call(args[1], elements[i], elements[j])
+		if isError(result) {
+			err = result
+			return false
+		}
+		return isTruthy(result)
+	})
+	if err != nil {
+		return err
+	}
+
+	return rt.Allocator().NewArray(elements)
+}
+
+// builtinZip returns an array of arrays holding the values of each argument
+// at the same index, as long as the shortest argument.
+func builtinZip(rt Runtime, args ...Object) Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want=1 or more")
+	}
+
+	columns := make([][]Object, len(args))
+	length := -1
+	for i, arg := range args {
+		values, ok := Iterate(arg)
+		if !ok {
+			return notIterableError("zip", arg)
+		}
+		columns[i] = values
+		if length < 0 || len(values) < length {
+			length = len(values)
+		}
+	}
+
+	rows := make([]Object, length)
+	for i := range rows {
+		row := make([]Object, len(columns))
+		for j, column := range columns {
+			row[j] = column[i]
+		}
+		rows[i] = rt.Allocator().NewArray(row)
+		if isError(rows[i]) {
+			return rows[i]
+		}
+	}
+
+	return rt.Allocator().NewArray(rows)
+}
+
+func builtinAny(rt Runtime, args ...Object) Object {
+	return findValue(rt, "any", args, true, func(value Object) Object { return TRUE }, FALSE)
+}
+
+func builtinAll(rt Runtime, args ...Object) Object {
+	return findValue(rt, "all", args, false, func(value Object) Object { return FALSE }, TRUE)
+}
+
+func builtinFind(rt Runtime, args ...Object) Object {
+	return findValue(rt, "find", args, true, func(value Object) Object { return value }, NULL)
+}
+
+// findValue calls the function in args with each value of the collection in
+// args until it returns a result whose truthiness is want, and then returns
+// found(value). It returns notFound if there is no such value.
+func findValue(rt Runtime, name string, args []Object, want bool, found func(Object) Object, notFound Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	values, ok := Iterate(args[0])
+	if !ok {
+		return notIterableError(name, args[0])
+	}
+
+	for _, value := range values {
+		result := rt.Call(args[1], value)
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) == want {
+			return found(value)
+		}
+	}
+
+	return notFound
+}
+
+// maxRange is the most elements range returns, about 100MB of them, so that
+// a mistaken call fails rather than exhausting memory when there is no
+// memory limit.
+const maxRange = 1 << 22
+
+// builtinRange returns the integers from start, 0 by default, up to but not
+// including end, step apart.
+func builtinRange(rt Runtime, args ...Object) Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newError("wrong number of arguments. got=%d, want=1 to 3", len(args))
+	}
+
+	bounds := []int64{0, 0, 1}
+	for i := range args {
+		bound, err := intArg("range", args, i)
+		if err != nil {
+			return err
+		}
+		bounds[i] = bound
+	}
+	if len(args) == 1 {
+		bounds[0], bounds[1] = 0, bounds[0]
+	}
+
+	start, end, step := bounds[0], bounds[1], bounds[2]
+	if step == 0 {
+		return newError("`range` step must not be 0")
+	}
+
+	// Count in uint64, as end - start may not fit in an int64.
+	var count uint64
+	if step > 0 && start < end {
+		count = (uint64(end)-uint64(start)-1)/uint64(step) + 1
+	} else if step < 0 && start > end {
+		count = (uint64(start)-uint64(end)-1)/(uint64(-(step+1))+1) + 1
+	}
+	if count > maxRange {
+		return newError("`range` too large: %d elements", count)
+	}
+
+	// Charge for the array and the integers in it before building them, so
+	// that a memory limit stops a large range from being allocated at all.
+	if err := rt.Allocator().Alloc(objectSize + (elementSize+objectSize)*int(count)); err != nil {
+		return err
+	}
+
+	elements := make([]Object, count)
+	for i := range elements {
+		elements[i] = &Integer{Value: start + int64(i)*step}
+	}
+
+	return &Array{Elements: elements}
+}
+
+// builtinReverse returns an array or a string in reverse order.
+func builtinReverse(rt Runtime, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *Array:
+		elements := make([]Object, len(arg.Elements))
+		for i, el := range arg.Elements {
+			elements[len(elements)-1-i] = el
+		}
+		return rt.Allocator().NewArray(elements)
+	case *String:
+		runes := []rune(arg.Value)
+		var out strings.Builder
+		for i := len(runes) - 1; i >= 0; i-- {
+			out.WriteRune(runes[i])
+		}
+		return rt.Allocator().NewString(out.String())
+	default:
+		return newError("argument to `reverse` must be ARRAY or STRING, got %s", arg.Type())
+	}
+}
+
+// compare orders numbers, strings and chars for sort.
+func compare(a, b Object) (int, *Error) {
+	switch {
+	case isNumeric(a) && isNumeric(b):
+		_, aFloat := a.(*Float)
+		_, bFloat := b.(*Float)
+		if !aFloat && !bFloat {
+			return CompareIntegers(a, b), nil
+		}
+		x, y := toFloat64(a), toFloat64(b)
+		switch {
+		case x < y:
+			return -1, nil
+		case x > y:
+			return 1, nil
+		default:
+			return 0, nil
+		}
+	case a.Type() == STRING_OBJ && b.Type() == STRING_OBJ:
+		return strings.Compare(a.(*String).Value, b.(*String).Value), nil
+	case a.Type() == CHAR_OBJ && b.Type() == CHAR_OBJ:
+		return int(a.(*Char).Value - b.(*Char).Value), nil
+	default:
+		return 0, newError("unknown operator: %s < %s", a.Type(), b.Type())
+	}
+}
+
+func notIterableError(name string, arg Object) *Error {
+	return newError("argument to `%s` must be ARRAY, STRING or HASH, got %s", name, arg.Type())
+}
+
+func isError(obj Object) bool {
+	return obj != nil && obj.Type() == ERROR_OBJ
+}
+
+func isTruthy(obj Object) bool {
+	switch obj {
+	case NULL, FALSE, nil:
+		return false
+	default:
+		return true
+	}
+}
@@ -1,32 +1,79 @@
 package object
 
+import "monkey-language/ast"
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
-	env.outer = env
+	env.outer = outer
 	return env
 
 }
 
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
+	s := make(map[string]binding)
 	return &Environment{store: s}
 }
 
 type Environment struct {
-	store map[string]Object
+	store map[string]binding
 	outer *Environment
 }
 
+type binding struct {
+	value    Object
+	constant bool
+	decl     ast.Node // the statement that declared a constant
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name] // inner scope
+	b, ok := e.store[name] // inner scope
 	if !ok && e.outer != nil {
 		obj, ok := e.outer.Get(name) // outer scope
 		return obj, ok
 	}
-	return obj, ok
+	return b.value, ok
 }
 
+// Set binds name to val in this environment, replacing any binding it has.
 func (e *Environment) Set(name string, val Object) Object {
-	e.store[name] = val
+	e.store[name] = binding{value: val}
 	return val
 }
+
+// Declare binds name to val in this environment, as a constant if constant
+// is set. It reports false, binding nothing, if name is a constant of this
+// environment declared by a statement other than decl, so a constant cannot
+// be shadowed in its own scope, while one declared in a loop body is bound
+// anew on every iteration.
+func (e *Environment) Declare(name string, val Object, constant bool, decl ast.Node) bool {
+	if b, ok := e.store[name]; ok && b.constant && b.decl != decl {
+		return false
+	}
+
+	e.store[name] = binding{value: val, constant: constant, decl: decl}
+	return true
+}
+
+// IsConst reports whether the innermost binding of name is a constant.
+func (e *Environment) IsConst(name string) bool {
+	for env := e; env != nil; env = env.outer {
+		if b, ok := env.store[name]; ok {
+			return b.constant
+		}
+	}
+	return false
+}
+
+// Assign updates name in the innermost environment that defines it. It
+// reports false, leaving every environment unchanged, if none does. Assign
+// does not check IsConst, callers do.
+func (e *Environment) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if b, ok := env.store[name]; ok {
+			b.value = val
+			env.store[name] = b
+			return true
+		}
+	}
+	return false
+}
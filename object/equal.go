@@ -0,0 +1,114 @@
+package object
+
+import "math/big"
+
+// Equal reports whether a and b have the same value: numbers compare by
+// value whatever their representation, strings, chars, booleans and null by
+// value, arrays element by element and hashes pair by pair, in any order.
+// Other objects, such as functions, are only equal to themselves.
+func Equal(a, b Object) bool {
+	return equal(a, b, map[[2]Object]bool{})
+}
+
+// equal compares a and b, assuming the pairs of arrays and hashes in seen,
+// which are being compared already, are equal, so that cycles end.
+func equal(a, b Object, seen map[[2]Object]bool) bool {
+	if a == b {
+		return true
+	}
+	if isNumeric(a) && isNumeric(b) {
+		return numericEqual(a, b)
+	}
+
+	switch a := a.(type) {
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Char:
+		b, ok := b.(*Char)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		if seen[[2]Object{a, b}] {
+			return true
+		}
+		seen[[2]Object{a, b}] = true
+		for i, el := range a.Elements {
+			if !equal(el, b.Elements[i], seen) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		if seen[[2]Object{a, b}] {
+			return true
+		}
+		seen[[2]Object{a, b}] = true
+		for key, pair := range a.pairs {
+			other, ok := b.pairs[key]
+			if !ok || !equal(pair.Value, other.Value, seen) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// Identical reports whether a and b are the same object. Numbers, strings,
+// chars, booleans and null cannot be changed, so they are identical when they
+// are equal, while arrays, hashes and functions are only identical to
+// themselves.
+func Identical(a, b Object) bool {
+	switch a.(type) {
+	case *Array, *Hash:
+		return a == b
+	default:
+		return Equal(a, b)
+	}
+}
+
+func isNumeric(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *BigInteger, *Float:
+		return true
+	}
+	return false
+}
+
+// numericEqual compares integers exactly, and otherwise compares a and b
+// as floats, as arithmetic mixing them does.
+func numericEqual(a, b Object) bool {
+	_, aFloat := a.(*Float)
+	_, bFloat := b.(*Float)
+	if aFloat || bFloat {
+		return toFloat64(a) == toFloat64(b)
+	}
+	return CompareIntegers(a, b) == 0
+}
+
+func toFloat64(obj Object) float64 {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value)
+	case *BigInteger:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	default:
+		return obj.(*Float).Value
+	}
+}
@@ -0,0 +1,107 @@
+package object
+
+// The builtins working on hashes. Like push, those changing a hash return a
+// new one and leave their argument as it is; all of them keep the insertion
+// order of the keys.
+
+func builtinKeys(rt Runtime, args ...Object) Object {
+	h, err := hashArg("keys", args, 1)
+	if err != nil {
+		return err
+	}
+	return rt.Allocator().NewArray(h.Keys())
+}
+
+func builtinValues(rt Runtime, args ...Object) Object {
+	h, err := hashArg("values", args, 1)
+	if err != nil {
+		return err
+	}
+	return rt.Allocator().NewArray(h.Values())
+}
+
+// builtinEntries returns the pairs of a hash as [key, value] arrays.
+func builtinEntries(rt Runtime, args ...Object) Object {
+	h, err := hashArg("entries", args, 1)
+	if err != nil {
+		return err
+	}
+
+	pairs := h.Pairs()
+	entries := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		entries[i] = rt.Allocator().NewArray([]Object{pair.Key, pair.Value})
+		if isError(entries[i]) {
+			return entries[i]
+		}
+	}
+	return rt.Allocator().NewArray(entries)
+}
+
+func builtinHas(rt Runtime, args ...Object) Object {
+	h, err := hashArg("has", args, 2)
+	if err != nil {
+		return err
+	}
+
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+	_, ok = h.Get(key.HashKey())
+	return nativeBoolToBooleanObject(ok)
+}
+
+// builtinDelete returns a copy of a hash without a key.
+func builtinDelete(rt Runtime, args ...Object) Object {
+	h, err := hashArg("delete", args, 2)
+	if err != nil {
+		return err
+	}
+
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+
+	pairs := []HashPair{}
+	for _, pair := range h.Pairs() {
+		if pair.Key.(Hashable).HashKey() != key.HashKey() {
+			pairs = append(pairs, pair)
+		}
+	}
+	return rt.Allocator().NewHash(pairs)
+}
+
+// builtinMerge returns a hash holding the pairs of all its arguments. A key
+// in several of them takes the value of the last one and keeps the position
+// of the first.
+func builtinMerge(rt Runtime, args ...Object) Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want=1 or more")
+	}
+
+	pairs := []HashPair{}
+	for _, arg := range args {
+		h, ok := arg.(*Hash)
+		if !ok {
+			return newError("argument to `merge` must be HASH, got %s", arg.Type())
+		}
+		pairs = append(pairs, h.Pairs()...)
+	}
+	return rt.Allocator().NewHash(pairs)
+}
+
+// hashArg checks that args holds want arguments, the first of them a hash,
+// and returns that hash.
+func hashArg(name string, args []Object, want int) (*Hash, *Error) {
+	if len(args) != want {
+		return nil, newError("wrong number of arguments. got=%d, want=%d", len(args), want)
+	}
+
+	h, ok := args[0].(*Hash)
+	if !ok {
+		return nil, newError("argument to `%s` must be HASH, got %s", name, args[0].Type())
+	}
+	return h, nil
+}
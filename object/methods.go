@@ -0,0 +1,74 @@
+package object
+
+import "sync"
+
+// Methods are builtins looked up by the type of the value before the '.' in
+// value.name(args), which they are called with as their first argument, so
+// that arr.push(x) is push(arr, x).
+var (
+	methodsMu sync.RWMutex
+	methods   = map[ObjectType]map[string]*Builtin{}
+)
+
+func init() {
+	defaults := map[ObjectType][]string{
+		ARRAY_OBJ: {"len", "first", "last", "rest", "push", "map", "filter", "reduce", "sort", "zip",
+			"any", "all", "find", "reverse", "join", "contains", "index_of"},
+		STRING_OBJ: {"len", "bytes", "chars", "map", "filter", "reduce", "zip", "any", "all", "find",
+			"reverse", "split", "trim", "upper", "lower", "contains", "index_of", "replace",
+			"starts_with", "ends_with", "repeat", "substr", "format", "to_int", "to_string"},
+		HASH_OBJ:    {"len", "keys", "values", "entries", "has", "delete", "merge"},
+		INTEGER_OBJ: {"to_int", "to_string"},
+		FLOAT_OBJ:   {"to_int", "to_string"},
+		BOOLEAN_OBJ: {"to_string"},
+		CHAR_OBJ:    {"to_string", "repeat"},
+	}
+	for t, names := range defaults {
+		for _, name := range names {
+			RegisterMethod(t, name, GetBuiltinByName(name))
+		}
+	}
+}
+
+// RegisterMethod makes fn a method called name of the values of type t,
+// replacing any method of that name. Embedders use it to add methods to
+// their own object types; it affects all programs, so it is best called
+// before any runs.
+func RegisterMethod(t ObjectType, name string, fn *Builtin) {
+	methodsMu.Lock()
+	defer methodsMu.Unlock()
+
+	if methods[t] == nil {
+		methods[t] = map[string]*Builtin{}
+	}
+	methods[t][name] = fn
+}
+
+// LookupMethod returns the method called name of the values of type t.
+func LookupMethod(t ObjectType, name string) (*Builtin, bool) {
+	methodsMu.RLock()
+	defer methodsMu.RUnlock()
+
+	fn, ok := methods[t][name]
+	return fn, ok
+}
+
+// Member returns obj.name: the method called name bound to obj or, for a hash
+// without such a method, the value of its "name" key, or NULL if there is
+// none.
+func Member(obj Object, name string) Object {
+	if method, ok := LookupMethod(obj.Type(), name); ok {
+		return &Builtin{Fn: func(rt Runtime, args ...Object) Object {
+			return method.Fn(rt, append([]Object{obj}, args...)...)
+		}}
+	}
+
+	if h, ok := obj.(*Hash); ok {
+		if pair, ok := h.Get((&String{Value: name}).HashKey()); ok {
+			return pair.Value
+		}
+		return NULL
+	}
+
+	return newError("unknown method: %s.%s", obj.Type(), name)
+}
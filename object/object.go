@@ -4,26 +4,47 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
 	"monkey-language/ast"
+	"monkey-language/code"
+	"monkey-language/token"
+	"strconv"
 	"strings"
 )
 
 type ObjectType string
 
-type BuiltinFunction func(args ...Object) Object
+type BuiltinFunction func(rt Runtime, args ...Object) Object
+
+// Runtime is the engine calling a builtin, which allocates the objects the
+// builtin returns through its Allocator, does integer arithmetic following
+// its Overflow policy and calls functions passed to it with Call.
+type Runtime interface {
+	Allocator() *Allocator
+	Overflow() Overflow
+	// Call calls fn with args and returns its result, or the error it
+	// raised, which the builtin should return as is.
+	Call(fn Object, args ...Object) Object
+}
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	STRING_OBJ       = "STRING"
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
-	BYTE_OBJ         = "BYTE"
+	CHAR_OBJ         = "CHAR"
 	HASH_OBJ         = "HASH"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 )
 
 type Object interface {
@@ -31,6 +52,14 @@ type Object interface {
 	Inspect() string
 }
 
+// TRUE, FALSE and NULL are the only booleans and null, shared by the engines
+// and the builtins, which tell them apart by identity.
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
 type Integer struct {
 	Value int64
 }
@@ -38,6 +67,32 @@ type Integer struct {
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 
+// BigInteger is an integer that does not fit in an int64, made when integer
+// arithmetic overflows. Integers that fit are always *Integer, so an Integer
+// and a BigInteger are never equal.
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (b *BigInteger) Inspect() string  { return b.Value.String() }
+func (b *BigInteger) Type() ObjectType { return INTEGER_OBJ }
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// Inspect formats the float so that it reads back as a float, 3.0 rather
+// than 3.
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if strings.ContainsAny(s, ".eEIN") {
+		return s
+	}
+	return s + ".0"
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -57,14 +112,144 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Break and Continue carry break and continue statements out of the blocks
+// of a loop body, like ReturnValue does for return.
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
+// ErrorKind tells errors that abort evaluation because a limit was reached,
+// and arithmetic errors, apart from other runtime errors, whose Kind is empty.
+type ErrorKind string
+
+// Fatal reports whether errors of kind k stop evaluation for good, so that
+// try cannot catch them.
+func (k ErrorKind) Fatal() bool {
+	switch k {
+	case CANCELLED_ERR, TIMEOUT_ERR, STEP_LIMIT_ERR, MEMORY_LIMIT_ERR:
+		return true
+	}
+	return false
+}
+
+const (
+	CANCELLED_ERR      ErrorKind = "CANCELLED"
+	TIMEOUT_ERR        ErrorKind = "TIMEOUT"
+	STEP_LIMIT_ERR     ErrorKind = "STEP_LIMIT"
+	STACK_OVERFLOW_ERR ErrorKind = "STACK_OVERFLOW"
+	MEMORY_LIMIT_ERR   ErrorKind = "MEMORY_LIMIT"
+
+	DIVISION_BY_ZERO_ERR ErrorKind = "DIVISION_BY_ZERO"
+	OVERFLOW_ERR         ErrorKind = "OVERFLOW"
+)
+
 type Error struct {
+	Kind    ErrorKind
 	Message string
+	Pos     token.Position // where the error occurred, if known
+	Stack   []Frame        // the calls the error was raised in, innermost first
+	Value   Object         // the value thrown by a throw statement, if any
+}
+
+// Throw returns the error raised by throwing value. Its message is value
+// itself if it is a string, the "message" entry of a hash that has one, or
+// else the inspected value.
+func Throw(value Object) *Error {
+	message := value.Inspect()
+
+	if hash, ok := value.(*Hash); ok {
+		key := &String{Value: "message"}
+		if pair, ok := hash.Get(key.HashKey()); ok && pair.Value.Type() == STRING_OBJ {
+			message = pair.Value.Inspect()
+		}
+	}
+
+	return &Error{Message: message, Value: value}
+}
+
+// Caught returns the value a catch clause binds for the error: the thrown
+// value, or for other errors a hash of their message, kind and stack.
+func (e *Error) Caught() Object {
+	if e.Value != nil {
+		return e.Value
+	}
+
+	kind := string(e.Kind)
+	if kind == "" {
+		kind = ERROR_OBJ
+	}
+
+	stack := make([]Object, len(e.Stack))
+	for i, frame := range e.Stack {
+		stack[i] = &String{Value: frame.String()}
+	}
+
+	return NewHash(
+		HashPair{Key: &String{Value: "message"}, Value: &String{Value: e.Message}},
+		HashPair{Key: &String{Value: "kind"}, Value: &String{Value: kind}},
+		HashPair{Key: &String{Value: "stack"}, Value: &Array{Elements: stack}},
+	)
+}
+
+// Frame is a call of a function on the stack of an error.
+type Frame struct {
+	Function string         // the name the function was bound to, if any
+	Pos      token.Position // where the function was called
 }
 
+// String formats the frame as the function name followed by the position of
+// the call, e.g. "add (3:8)".
+func (f Frame) String() string {
+	name := f.Function
+	if name == "" {
+		name = "fn"
+	}
+	return name + " (" + f.Pos.String() + ")"
+}
+
+// maxTraceFrames is how many frames StackTrace shows.
+const maxTraceFrames = 20
+
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+	return "ERROR: " + e.Message
+}
+
+// Error lets the virtual machine return runtime errors as Go errors.
+func (e *Error) Error() string { return e.Message }
+
+// StackTrace formats the stack of the error one frame per line, e.g.
+//
+//	at add (3:8)
+//	at fn (7:2)
+//
+// eliding the outermost frames of very deep stacks.
+func (e *Error) StackTrace() string {
+	var out bytes.Buffer
+
+	for i, frame := range e.Stack {
+		if i == maxTraceFrames {
+			fmt.Fprintf(&out, "  ... %d more\n", len(e.Stack)-i)
+			break
+		}
+
+		fmt.Fprintf(&out, "  at %s\n", frame)
+	}
+
+	return out.String()
+}
 
 type Function struct {
+	Name       string // the name it is bound to by a let statement, if any
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
@@ -108,12 +293,38 @@ type Array struct {
 }
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
-func (ao *Array) Inspect() string {
+func (ao *Array) Inspect() string  { return inspect(ao, map[Object]bool{}) }
+
+// inspect returns the text of obj. inside holds the arrays and hashes being
+// printed around obj, so that one containing itself prints as [...] or {...}
+// where it recurs.
+func inspect(obj Object, inside map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		if inside[obj] {
+			return "[...]"
+		}
+		inside[obj] = true
+		defer delete(inside, obj)
+		return obj.inspect(inside)
+	case *Hash:
+		if inside[obj] {
+			return "{...}"
+		}
+		inside[obj] = true
+		defer delete(inside, obj)
+		return obj.inspect(inside)
+	default:
+		return obj.Inspect()
+	}
+}
+
+func (ao *Array) inspect(inside map[Object]bool) string {
 	var out bytes.Buffer
 
 	elements := []string{}
 	for _, el := range ao.Elements {
-		elements = append(elements, el.Inspect())
+		elements = append(elements, inspect(el, inside))
 	}
 
 	out.WriteString("[")
@@ -123,12 +334,13 @@ func (ao *Array) Inspect() string {
 	return out.String()
 }
 
-type Byte struct {
-	Value byte
+// Char is a single Unicode code point, the result of indexing a string.
+type Char struct {
+	Value rune
 }
 
-func (bt *Byte) Type() ObjectType { return BYTE_OBJ }
-func (bt *Byte) Inspect() string  { return fmt.Sprintf("%d", bt.Value) }
+func (c *Char) Type() ObjectType { return CHAR_OBJ }
+func (c *Char) Inspect() string  { return string(c.Value) }
 
 type HashKey struct {
 	Type  ObjectType
@@ -151,6 +363,34 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+func (b *BigInteger) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(b.Value.String()))
+
+	return HashKey{Type: bigIntegerKey, Value: h.Sum64()}
+}
+
+// bigIntegerKey keeps the hash keys of big integers apart from those of
+// integers.
+const bigIntegerKey ObjectType = "BIG_INTEGER"
+
+// HashKey of an integral float is that of the integer it equals, so that
+// {1: "a"}[1.0] finds the pair.
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0) {
+		if f.Value >= math.MinInt64 && f.Value < math.MaxInt64 {
+			return (&Integer{Value: int64(f.Value)}).HashKey()
+		}
+		value, _ := big.NewFloat(f.Value).Int(nil)
+		return (&BigInteger{Value: value}).HashKey()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
+func (c *Char) HashKey() HashKey {
+	return HashKey{Type: c.Type(), Value: uint64(c.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -163,17 +403,74 @@ type HashPair struct {
 	Value Object
 }
 
+// Hash maps keys to values, keeping the keys in the order they were first
+// inserted in.
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	pairs map[HashKey]HashPair
+	order []HashKey
+}
+
+// NewHash returns a hash holding pairs, whose keys must be Hashable. A key
+// given twice keeps its first position and its last value.
+func NewHash(pairs ...HashPair) *Hash {
+	h := &Hash{pairs: make(map[HashKey]HashPair, len(pairs))}
+	for _, pair := range pairs {
+		h.Set(pair.Key.(Hashable).HashKey(), pair)
+	}
+	return h
+}
+
+func (h *Hash) Get(key HashKey) (HashPair, bool) {
+	pair, ok := h.pairs[key]
+	return pair, ok
+}
+
+// Set stores pair under key, after the other keys if key is new, and
+// reports whether it was.
+func (h *Hash) Set(key HashKey, pair HashPair) bool {
+	_, ok := h.pairs[key]
+	if !ok {
+		h.order = append(h.order, key)
+	}
+	h.pairs[key] = pair
+	return !ok
+}
+
+// Delete removes key from the hash, reporting whether it was there.
+func (h *Hash) Delete(key HashKey) bool {
+	if _, ok := h.pairs[key]; !ok {
+		return false
+	}
+	delete(h.pairs, key)
+	for i, k := range h.order {
+		if k == key {
+			h.order = append(h.order[:i], h.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (h *Hash) Len() int { return len(h.order) }
+
+// Pairs returns the pairs of the hash in insertion order.
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, len(h.order))
+	for i, key := range h.order {
+		pairs[i] = h.pairs[key]
+	}
+	return pairs
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
-func (h *Hash) Inspect() string {
+func (h *Hash) Inspect() string  { return inspect(h, map[Object]bool{}) }
+
+func (h *Hash) inspect(inside map[Object]bool) string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+	for _, pair := range h.Pairs() {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), inspect(pair.Value, inside)))
 	}
 
 	out.WriteString("{")
@@ -183,6 +480,71 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// Keys returns the keys of the hash in insertion order.
+func (h *Hash) Keys() []Object {
+	keys := make([]Object, len(h.order))
+	for i, key := range h.order {
+		keys[i] = h.pairs[key].Key
+	}
+	return keys
+}
+
+// Values returns the values of the hash in insertion order.
+func (h *Hash) Values() []Object {
+	values := make([]Object, len(h.order))
+	for i, key := range h.order {
+		values[i] = h.pairs[key].Value
+	}
+	return values
+}
+
+// Iterate returns the values a for loop over obj visits: the elements of an
+// array, the chars of a string or the keys of a hash. It reports false if obj
+// cannot be iterated over.
+func Iterate(obj Object) ([]Object, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.Elements, true
+	case *String:
+		chars := []Object{}
+		for _, ch := range obj.Value {
+			chars = append(chars, &Char{Value: ch})
+		}
+		return chars, true
+	case *Hash:
+		return obj.Keys(), true
+	default:
+		return nil, false
+	}
+}
+
 type Hashable interface {
 	HashKey() HashKey
 }
+
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	Name          string
+	// SourceMap maps the offset of instructions that can fail at runtime
+	// to the position of the node they were compiled from.
+	SourceMap map[int]token.Position
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+// Type reports closures as functions, they are what the compiler turns
+// function literals into.
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
@@ -1,6 +1,10 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"math/big"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -21,3 +25,317 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content has same hash keys")
 	}
 }
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3, "3.0"},
+		{3.14, "3.14"},
+		{-0.5, "-0.5"},
+		{1e21, "1e+21"},
+		{1e-9, "1e-09"},
+		{0.30000000000000004, "0.30000000000000004"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("Inspect wrong, got=%q, want=%q", f.Inspect(), tt.expected)
+		}
+	}
+}
+
+// overflowRuntime is a Runtime with an Overflow policy and no memory limit,
+// which can only call builtins.
+type overflowRuntime Overflow
+
+func (r overflowRuntime) Allocator() *Allocator { return nil }
+func (r overflowRuntime) Overflow() Overflow    { return Overflow(r) }
+
+func (r overflowRuntime) Call(fn Object, args ...Object) Object {
+	return fn.(*Builtin).Fn(r, args...)
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	bigInt := func(s string) Object {
+		v, _ := new(big.Int).SetString(s, 10)
+		return &BigInteger{Value: v}
+	}
+	integer := func(v int64) Object { return &Integer{Value: v} }
+
+	tests := []struct {
+		op          string
+		left, right Object
+		overflow    Overflow
+		expected    string
+	}{
+		{"+", integer(1), integer(2), OverflowError, "3"},
+		{"+", integer(math.MaxInt64), integer(1), OverflowPromote, "9223372036854775808"},
+		{"-", integer(math.MinInt64), integer(1), OverflowWrap, "9223372036854775807"},
+		{"-", integer(math.MinInt64), integer(1), OverflowError, "integer overflow: -9223372036854775808 - 1"},
+		{"-", integer(-1), integer(math.MaxInt64), OverflowError, "-9223372036854775808"},
+		{"*", integer(-1), integer(math.MinInt64), OverflowError, "integer overflow: -1 * -9223372036854775808"},
+		{"*", integer(3037000500), integer(3037000500), OverflowError, "integer overflow: 3037000500 * 3037000500"},
+		{"*", integer(3037000500), integer(3037000500), OverflowPromote, "9223372037000250000"},
+		{"*", integer(0), integer(math.MinInt64), OverflowError, "0"},
+		{"/", integer(math.MinInt64), integer(-1), OverflowWrap, "-9223372036854775808"},
+		{"/", integer(math.MinInt64), integer(-1), OverflowError, "integer overflow: -9223372036854775808 / -1"},
+		{"/", integer(math.MinInt64), integer(-1), OverflowPromote, "9223372036854775808"},
+		{"%", integer(math.MinInt64), integer(-1), OverflowError, "0"},
+		{"/", integer(1), integer(0), OverflowWrap, "division by zero"},
+		{"%", integer(1), integer(0), OverflowWrap, "division by zero"},
+		{"/", bigInt("100000000000000000000"), integer(0), OverflowPromote, "division by zero"},
+		{"<<", integer(-1), integer(63), OverflowError, "-9223372036854775808"},
+		{"<<", integer(1), integer(64), OverflowWrap, "0"},
+		{"<<", integer(1), integer(64), OverflowError, "integer overflow: 1 << 64"},
+		{"<<", integer(1), integer(64), OverflowPromote, "18446744073709551616"},
+		{"<<", integer(1), integer(-1), OverflowWrap, "negative shift count: -1"},
+		{"<<", integer(1), integer(1 << 30), OverflowPromote, "shift count too large: 1073741824"},
+		{">>", bigInt("-100000000000000000000"), integer(100), OverflowPromote, "-1"},
+		{">>", bigInt("100000000000000000000"), integer(4), OverflowPromote, "6250000000000000000"},
+		{"-", bigInt("9223372036854775808"), integer(1), OverflowError, "9223372036854775807"},
+		{"+", bigInt("9223372036854775808"), integer(1), OverflowWrap, "-9223372036854775807"},
+		{"+", bigInt("9223372036854775808"), integer(1), OverflowError, "integer overflow: 9223372036854775808 + 1"},
+		{"%", bigInt("100000000000000000007"), integer(10), OverflowPromote, "7"},
+		{"/", bigInt("-100000000000000000000"), integer(7), OverflowPromote, "-14285714285714285714"},
+		{"&", bigInt("18446744073709551615"), integer(-256), OverflowPromote, "18446744073709551360"},
+		{"&&", integer(1), integer(2), OverflowPromote, "unknown operator: INTEGER && INTEGER"},
+	}
+
+	for _, tt := range tests {
+		result := IntegerArithmetic(overflowRuntime(tt.overflow), tt.op, tt.left, tt.right)
+		var actual string
+		if err, ok := result.(*Error); ok {
+			actual = err.Message
+		} else {
+			actual = result.Inspect()
+		}
+
+		if actual != tt.expected {
+			t.Errorf("%s %s %s wrong, got=%q, want=%q", tt.left.Inspect(), tt.op, tt.right.Inspect(), actual, tt.expected)
+		}
+
+		if _, ok := result.(*BigInteger); ok && result.(*BigInteger).Value.IsInt64() {
+			t.Errorf("%s %s %s returned a BigInteger that fits in an int64", tt.left.Inspect(), tt.op, tt.right.Inspect())
+		}
+	}
+}
+
+func TestIntegerPrefix(t *testing.T) {
+	min := &Integer{Value: math.MinInt64}
+
+	if result := IntegerPrefix(overflowRuntime(OverflowPromote), "-", min); result.Inspect() != "9223372036854775808" {
+		t.Errorf("wrong negation, got=%q", result.Inspect())
+	}
+	if result := IntegerPrefix(overflowRuntime(OverflowWrap), "-", min); result.Inspect() != "-9223372036854775808" {
+		t.Errorf("wrong wrapped negation, got=%q", result.Inspect())
+	}
+	if result := IntegerPrefix(overflowRuntime(OverflowError), "-", min); result.Inspect() != "ERROR: integer overflow: -(-9223372036854775808)" {
+		t.Errorf("wrong negation error, got=%q", result.Inspect())
+	}
+
+	negated := IntegerPrefix(overflowRuntime(OverflowPromote), "-", min)
+	if result := IntegerPrefix(overflowRuntime(OverflowPromote), "-", negated); result.(*Integer).Value != math.MinInt64 {
+		t.Errorf("negating twice did not give an Integer back, got=%q", result.Inspect())
+	}
+	if result := IntegerPrefix(overflowRuntime(OverflowPromote), "~", negated); result.Inspect() != "-9223372036854775809" {
+		t.Errorf("wrong complement, got=%q", result.Inspect())
+	}
+}
+
+func TestBigIntegerHashKey(t *testing.T) {
+	a := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 64)}
+	b := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 64)}
+	c := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 65)}
+	zero := &Integer{Value: 0}
+
+	if a.HashKey() != b.HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+	if a.HashKey() == c.HashKey() || a.HashKey() == zero.HashKey() {
+		t.Errorf("integers with different values have same hash keys")
+	}
+	if CompareIntegers(a, c) != -1 || CompareIntegers(c, a) != 1 || CompareIntegers(a, b) != 0 || CompareIntegers(zero, a) != -1 {
+		t.Errorf("wrong comparison of big integers")
+	}
+}
+
+func TestFloatHashKey(t *testing.T) {
+	tests := []struct {
+		float   float64
+		integer Hashable
+	}{
+		{1, &Integer{Value: 1}},
+		{-3, &Integer{Value: -3}},
+		{0, &Integer{Value: 0}},
+		{math.Copysign(0, -1), &Integer{Value: 0}},
+		{-9223372036854775808, &Integer{Value: math.MinInt64}},
+		{9223372036854775808, &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 63)}},
+		{1e21, &BigInteger{Value: new(big.Int).Exp(big.NewInt(10), big.NewInt(21), nil)}},
+	}
+
+	for _, tt := range tests {
+		if (&Float{Value: tt.float}).HashKey() != tt.integer.HashKey() {
+			t.Errorf("float %g and integer %s have different hash keys", tt.float, tt.integer.(Object).Inspect())
+		}
+	}
+
+	if (&Float{Value: 1.5}).HashKey() == (&Integer{Value: 1}).HashKey() {
+		t.Errorf("float 1.5 has the hash key of integer 1")
+	}
+	if (&Float{Value: 1.5}).HashKey() != (&Float{Value: 1.5}).HashKey() {
+		t.Errorf("floats with same value have different hash keys")
+	}
+}
+
+func TestHashOrder(t *testing.T) {
+	a, b, c := &String{Value: "a"}, &String{Value: "b"}, &String{Value: "c"}
+	h := NewHash(HashPair{Key: c, Value: c}, HashPair{Key: a, Value: a})
+
+	if !h.Set(b.HashKey(), HashPair{Key: b, Value: b}) {
+		t.Errorf("Set of a new key reported false")
+	}
+	if h.Set(c.HashKey(), HashPair{Key: c, Value: a}) {
+		t.Errorf("Set of an existing key reported true")
+	}
+	if h.Inspect() != "{c: a, a: a, b: b}" {
+		t.Errorf("wrong order, got=%q", h.Inspect())
+	}
+
+	if !h.Delete(a.HashKey()) || h.Delete(a.HashKey()) {
+		t.Errorf("wrong result of Delete")
+	}
+	h.Set(a.HashKey(), HashPair{Key: a, Value: a})
+	if h.Inspect() != "{c: a, b: b, a: a}" || h.Len() != 3 {
+		t.Errorf("wrong order after Delete, got=%q", h.Inspect())
+	}
+
+	keys := h.Keys()
+	values := h.Values()
+	if len(keys) != 3 || keys[0] != c || keys[2] != a || values[0] != a || values[1] != b {
+		t.Errorf("wrong keys or values, got=%v %v", keys, values)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	str := func(s string) Object { return &String{Value: s} }
+	integer := func(v int64) Object { return &Integer{Value: v} }
+	array := func(elements ...Object) *Array { return &Array{Elements: elements} }
+	hash := func(pairs ...Object) *Hash {
+		h := NewHash()
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i].(Hashable).HashKey(), HashPair{Key: pairs[i], Value: pairs[i+1]})
+		}
+		return h
+	}
+
+	cycleA, cycleB, cycleC := array(integer(1)), array(integer(1)), array(integer(2))
+	cycleA.Elements = append(cycleA.Elements, cycleA)
+	cycleB.Elements = append(cycleB.Elements, cycleB)
+	cycleC.Elements = append(cycleC.Elements, cycleC)
+
+	fn := &Builtin{}
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{integer(1), integer(1), true},
+		{integer(1), &Float{Value: 1}, true},
+		{&BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 70)}, &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 70)}, true},
+		{&BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 70)}, integer(1), false},
+		{&Float{Value: math.NaN()}, &Float{Value: math.NaN()}, false},
+		{str("a"), str("a"), true},
+		{str("a"), str("b"), false},
+		{str("a"), &Char{Value: 'a'}, false},
+		{&Boolean{Value: true}, TRUE, true},
+		{NULL, &Null{}, true},
+		{NULL, FALSE, false},
+		{integer(0), FALSE, false},
+		{array(integer(1), str("x")), array(integer(1), str("x")), true},
+		{array(integer(1), str("x")), array(integer(1), str("y")), false},
+		{array(integer(1)), array(integer(1), integer(2)), false},
+		{array(array(integer(1))), array(array(&Float{Value: 1})), true},
+		{hash(str("a"), integer(1), str("b"), integer(2)), hash(str("b"), integer(2), str("a"), integer(1)), true},
+		{hash(str("a"), integer(1)), hash(str("a"), integer(2)), false},
+		{hash(str("a"), integer(1)), hash(str("b"), integer(1)), false},
+		{hash(str("a"), integer(1)), array(integer(1)), false},
+		{cycleA, cycleB, true},
+		{cycleA, cycleC, false},
+		{fn, fn, true},
+		{fn, &Builtin{}, false},
+	}
+
+	for i, tt := range tests {
+		if Equal(tt.a, tt.b) != tt.expected {
+			t.Errorf("tests[%d]: Equal(%s, %s) wrong, want=%t", i, tt.a.Inspect(), tt.b.Inspect(), tt.expected)
+		}
+		if Equal(tt.b, tt.a) != tt.expected {
+			t.Errorf("tests[%d]: Equal(%s, %s) wrong, want=%t", i, tt.b.Inspect(), tt.a.Inspect(), tt.expected)
+		}
+	}
+
+	a := array(integer(1))
+	if !Identical(a, a) || Identical(a, array(integer(1))) || !Identical(str("a"), str("a")) || Identical(integer(1), integer(2)) {
+		t.Errorf("wrong result of Identical")
+	}
+}
+
+func TestInspectCycles(t *testing.T) {
+	a := &Array{Elements: []Object{&Integer{Value: 1}}}
+	a.Elements = append(a.Elements, a)
+
+	h := NewHash()
+	key := &String{Value: "self"}
+	h.Set(key.HashKey(), HashPair{Key: key, Value: h})
+	shared := &Array{}
+	h.Set((&String{Value: "a"}).HashKey(), HashPair{Key: &String{Value: "a"}, Value: &Array{Elements: []Object{shared, shared, a}}})
+
+	tests := []struct {
+		obj      Object
+		expected string
+	}{
+		{a, "[1, [...]]"},
+		{h, "{self: {...}, a: [[], [], [1, [...]]]}"},
+	}
+
+	for _, tt := range tests {
+		if tt.obj.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect, expected=%q, got=%q", tt.expected, tt.obj.Inspect())
+		}
+	}
+}
+
+func TestAllocator(t *testing.T) {
+	alloc := NewAllocator(101)
+
+	if obj := alloc.NewString("hello"); obj.Inspect() != "hello" {
+		t.Fatalf("wrong string, got=%q", obj.Inspect())
+	}
+	if alloc.Allocated() != 21 {
+		t.Errorf("wrong allocated bytes, got=%d", alloc.Allocated())
+	}
+
+	hash := alloc.NewHash(nil).(*Hash)
+	key := &String{Value: "k"}
+	alloc.SetPair(hash, key.HashKey(), HashPair{Key: key, Value: key})
+	alloc.SetPair(hash, key.HashKey(), HashPair{Key: key, Value: key})
+	if alloc.Allocated() != 101 {
+		t.Errorf("wrong allocated bytes, got=%d", alloc.Allocated())
+	}
+
+	err, ok := alloc.NewArray(nil).(*Error)
+	if !ok {
+		t.Fatalf("expected an error once over the limit")
+	}
+	if err.Kind != MEMORY_LIMIT_ERR || err.Message != "memory limit of 101 bytes exceeded" {
+		t.Errorf("wrong error, got=%s %q", err.Kind, err.Message)
+	}
+
+	var unlimited *Allocator
+	if obj := unlimited.NewString("x"); obj.Inspect() != "x" || unlimited.Allocated() != 0 {
+		t.Errorf("nil allocator must not count")
+	}
+}
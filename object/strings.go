@@ -0,0 +1,572 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+// The builtins working on strings. Those taking a substring also take a
+// char, the result of indexing a string.
+
+// maxStringLen is the longest string repeat builds, so that a mistaken call
+// fails rather than exhausting memory when there is no memory limit.
+const maxStringLen = 1 << 30
+
+// builtinSplit splits a string around each instance of a separator, or
+// around runs of white space if there is none.
+func builtinSplit(rt Runtime, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	str, err := stringArg("split", args, 0)
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		return newStringArray(rt, strings.Fields(str))
+	}
+
+	sep, err := textArg("split", args, 1)
+	if err != nil {
+		return err
+	}
+	return newStringArray(rt, strings.Split(str, sep))
+}
+
+// builtinJoin concatenates the strings and chars of an array, with a
+// separator between them if one is given.
+func builtinJoin(rt Runtime, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	if args[0].Type() != ARRAY_OBJ {
+		return newError("argument to `join` must be ARRAY, got %s", args[0].Type())
+	}
+
+	sep := ""
+	if len(args) == 2 {
+		var err *Error
+		if sep, err = textArg("join", args, 1); err != nil {
+			return err
+		}
+	}
+
+	elements := args[0].(*Array).Elements
+	parts := make([]string, len(elements))
+	for i, el := range elements {
+		text, ok := toText(el)
+		if !ok {
+			return newError("elements of `join` must be STRING or CHAR, got %s", el.Type())
+		}
+		parts[i] = text
+	}
+
+	return rt.Allocator().NewString(strings.Join(parts, sep))
+}
+
+// builtinTrim removes leading and trailing white space, or the chars of a
+// cutset if one is given.
+func builtinTrim(rt Runtime, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	str, err := stringArg("trim", args, 0)
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		return rt.Allocator().NewString(strings.TrimSpace(str))
+	}
+
+	cutset, err := textArg("trim", args, 1)
+	if err != nil {
+		return err
+	}
+	return rt.Allocator().NewString(strings.Trim(str, cutset))
+}
+
+func builtinUpper(rt Runtime, args ...Object) Object {
+	return mapString(rt, "upper", args, strings.ToUpper)
+}
+
+func builtinLower(rt Runtime, args ...Object) Object {
+	return mapString(rt, "lower", args, strings.ToLower)
+}
+
+func mapString(rt Runtime, name string, args []Object, f func(string) string) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	str, err := stringArg(name, args, 0)
+	if err != nil {
+		return err
+	}
+	return rt.Allocator().NewString(f(str))
+}
+
+// builtinContains reports whether a string contains a substring, or an array
+// an element equal to a value.
+func builtinContains(rt Runtime, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	index := indexOf("contains", args)
+	if isError(index) {
+		return index
+	}
+	return nativeBoolToBooleanObject(index.(*Integer).Value >= 0)
+}
+
+// builtinIndexOf returns the index of the first char of a substring in a
+// string, or of the first element equal to a value in an array, and -1 if
+// there is none.
+func builtinIndexOf(rt Runtime, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	return indexOf("index_of", args)
+}
+
+func indexOf(name string, args []Object) Object {
+	if arr, ok := args[0].(*Array); ok {
+		for i, el := range arr.Elements {
+			if Equal(el, args[1]) {
+				return &Integer{Value: int64(i)}
+			}
+		}
+		return &Integer{Value: -1}
+	}
+
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `%s` must be STRING or ARRAY, got %s", name, args[0].Type())
+	}
+	sub, err := textArg(name, args, 1)
+	if err != nil {
+		return err
+	}
+
+	i := strings.Index(str.Value, sub)
+	if i < 0 {
+		return &Integer{Value: -1}
+	}
+	return &Integer{Value: int64(utf8.RuneCountInString(str.Value[:i]))}
+}
+
+// builtinReplace replaces the instances of old in a string by new, all of
+// them or the first n if n is given.
+func builtinReplace(rt Runtime, args ...Object) Object {
+	if len(args) != 3 && len(args) != 4 {
+		return newError("wrong number of arguments. got=%d, want=3 or 4", len(args))
+	}
+
+	str, err := stringArg("replace", args, 0)
+	if err != nil {
+		return err
+	}
+	old, err := textArg("replace", args, 1)
+	if err != nil {
+		return err
+	}
+	replacement, err := textArg("replace", args, 2)
+	if err != nil {
+		return err
+	}
+
+	n := -1
+	if len(args) == 4 {
+		count, err := intArg("replace", args, 3)
+		if err != nil {
+			return err
+		}
+		if count < math.MaxInt32 {
+			n = int(count)
+		}
+	}
+
+	return rt.Allocator().NewString(strings.Replace(str, old, replacement, n))
+}
+
+func builtinStartsWith(rt Runtime, args ...Object) Object {
+	return testString(rt, "starts_with", args, strings.HasPrefix)
+}
+
+func builtinEndsWith(rt Runtime, args ...Object) Object {
+	return testString(rt, "ends_with", args, strings.HasSuffix)
+}
+
+func testString(rt Runtime, name string, args []Object, f func(string, string) bool) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	str, err := stringArg(name, args, 0)
+	if err != nil {
+		return err
+	}
+	sub, err := textArg(name, args, 1)
+	if err != nil {
+		return err
+	}
+	return nativeBoolToBooleanObject(f(str, sub))
+}
+
+func builtinRepeat(rt Runtime, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	str, err := textArg("repeat", args, 0)
+	if err != nil {
+		return err
+	}
+	count, err := intArg("repeat", args, 1)
+	if err != nil {
+		return err
+	}
+	if count < 0 {
+		return newError("negative `repeat` count: %d", count)
+	}
+	if len(str) > 0 && count > int64(maxStringLen/len(str)) {
+		return newError("`repeat` result too large: %d bytes", new(big.Int).Mul(big.NewInt(int64(len(str))), big.NewInt(count)))
+	}
+
+	// Charge before building the string, which may be large.
+	if err := rt.Allocator().Alloc(objectSize + len(str)*int(count)); err != nil {
+		return err
+	}
+	return &String{Value: strings.Repeat(str, int(count))}
+}
+
+// builtinSubstr returns the chars of a string from start, to its end or for
+// length chars if length is given. A range past the end of the string is cut
+// short.
+func builtinSubstr(rt Runtime, args ...Object) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+	}
+
+	str, err := stringArg("substr", args, 0)
+	if err != nil {
+		return err
+	}
+
+	bounds := []int64{0, math.MaxInt64}
+	for i := range args[1:] {
+		bound, err := intArg("substr", args, i+1)
+		if err != nil {
+			return err
+		}
+		if bound < 0 {
+			return newError("negative `substr` bound: %d", bound)
+		}
+		bounds[i] = bound
+	}
+
+	runes := []rune(str)
+	start, length := bounds[0], bounds[1]
+	if start > int64(len(runes)) {
+		start = int64(len(runes))
+	}
+	if length > int64(len(runes))-start {
+		length = int64(len(runes)) - start
+	}
+
+	return rt.Allocator().NewString(string(runes[start : start+length]))
+}
+
+// builtinFormat formats its arguments as Go's fmt.Sprintf does. Each verb
+// takes one argument of a type it formats: %v any value, %s and %q any value
+// as the text it prints as, %t a boolean, %d, %b, %o and %O an integer, %c
+// an integer or char, %x and %X an integer, float, string or char, and %e,
+// %f and %g a float or integer. A verb can have flags, a width and a
+// precision, but not * or an explicit argument index.
+func builtinFormat(rt Runtime, args ...Object) Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want=1 or more")
+	}
+
+	format, err := stringArg("format", args, 0)
+	if err != nil {
+		return err
+	}
+
+	directives, err := formatDirectives(format)
+	if err != nil {
+		return err
+	}
+	if len(args)-1 != len(directives) {
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), len(directives)+1)
+	}
+
+	values := make([]interface{}, len(directives))
+	for i, arg := range args[1:] {
+		verb, _ := utf8.DecodeLastRuneInString(directives[i])
+		value, ok := formatArg(verb, arg)
+		if !ok {
+			return newError("argument to `format` for %s must be %s, got %s", directives[i], formatVerbs[verb], arg.Type())
+		}
+		values[i] = value
+	}
+
+	return rt.Allocator().NewString(fmt.Sprintf(format, values...))
+}
+
+// formatVerbs maps the verbs format supports to the types they take, empty
+// for any type.
+var formatVerbs = map[rune]string{
+	'v': "", 's': "", 'q': "",
+	't': "BOOLEAN",
+	'd': "INTEGER", 'b': "INTEGER", 'o': "INTEGER", 'O': "INTEGER",
+	'c': "INTEGER or CHAR",
+	'x': "INTEGER, FLOAT, STRING or CHAR", 'X': "INTEGER, FLOAT, STRING or CHAR",
+	'e': "FLOAT or INTEGER", 'E': "FLOAT or INTEGER",
+	'f': "FLOAT or INTEGER", 'F': "FLOAT or INTEGER",
+	'g': "FLOAT or INTEGER", 'G': "FLOAT or INTEGER",
+}
+
+// formatDirectives returns the directives of format that take an argument,
+// such as %5.2f, in order.
+func formatDirectives(format string) ([]string, *Error) {
+	var directives []string
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+
+		start := i
+		for i++; i < len(format) && strings.IndexByte("+-# 0", format[i]) >= 0; i++ {
+		}
+		for ; i < len(format) && '0' <= format[i] && format[i] <= '9'; i++ {
+		}
+		if i < len(format) && format[i] == '.' {
+			for i++; i < len(format) && '0' <= format[i] && format[i] <= '9'; i++ {
+			}
+		}
+		if i == len(format) {
+			return nil, newError("`format` ends with an incomplete verb: %s", format[start:])
+		}
+
+		verb, size := utf8.DecodeRuneInString(format[i:])
+		i += size - 1
+		if verb == '%' {
+			continue
+		}
+		if _, ok := formatVerbs[verb]; !ok {
+			return nil, newError("unknown `format` verb: %s", format[start:i+1])
+		}
+		directives = append(directives, format[start:i+1])
+	}
+
+	return directives, nil
+}
+
+// formatArg returns the Go value format passes to fmt.Sprintf for arg to be
+// formatted with verb, or false if verb does not take values of its type.
+func formatArg(verb rune, arg Object) (interface{}, bool) {
+	switch verb {
+	case 'v':
+		return formatValue(arg), true
+	case 's', 'q':
+		if text, ok := toText(arg); ok {
+			return text, true
+		}
+		return arg.Inspect(), true
+	case 't':
+		if arg, ok := arg.(*Boolean); ok {
+			return arg.Value, true
+		}
+	case 'd', 'b', 'o', 'O':
+		switch arg.(type) {
+		case *Integer, *BigInteger:
+			return formatValue(arg), true
+		}
+	case 'c':
+		switch arg := arg.(type) {
+		case *Integer:
+			return arg.Value, true
+		case *Char:
+			return arg.Value, true
+		}
+	case 'x', 'X':
+		switch arg.(type) {
+		case *Integer, *BigInteger, *Float, *String, *Char:
+			return formatValue(arg), true
+		}
+	default:
+		switch arg := arg.(type) {
+		case *Float:
+			return arg.Value, true
+		case *Integer:
+			return float64(arg.Value), true
+		case *BigInteger:
+			return new(big.Float).SetInt(arg.Value), true
+		}
+	}
+	return nil, false
+}
+
+// formatValue returns the Go value an object is formatted as: the value an
+// integer, float, string, char or boolean holds, and the text other objects
+// print as.
+func formatValue(arg Object) interface{} {
+	switch arg := arg.(type) {
+	case *Integer:
+		return arg.Value
+	case *BigInteger:
+		return arg.Value
+	case *Float:
+		return arg.Value
+	case *String:
+		return arg.Value
+	case *Char:
+		return string(arg.Value)
+	case *Boolean:
+		return arg.Value
+	default:
+		return arg.Inspect()
+	}
+}
+
+// builtinToInt converts a string in the given base, 10 by default, or a
+// float, which it truncates, to an integer.
+func builtinToInt(rt Runtime, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	base, err := baseArg("to_int", args)
+	if err != nil {
+		return err
+	}
+
+	switch arg := args[0].(type) {
+	case *Integer, *BigInteger:
+		return arg
+	case *Float:
+		if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+			return newError("cannot convert %s to INTEGER", arg.Inspect())
+		}
+		value, _ := big.NewFloat(arg.Value).Int(nil)
+		return fitInteger(rt, value, "to_int("+arg.Inspect()+")")
+	case *String:
+		value, ok := new(big.Int).SetString(arg.Value, base)
+		if !ok {
+			return newError("invalid integer: %q", arg.Value)
+		}
+		return fitInteger(rt, value, fmt.Sprintf("to_int(%q)", arg.Value))
+	default:
+		return newError("argument to `to_int` must be STRING, FLOAT or INTEGER, got %s", arg.Type())
+	}
+}
+
+// builtinToString returns the text an object prints as, with integers
+// written in the given base, 10 by default.
+func builtinToString(rt Runtime, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+
+	base, err := baseArg("to_string", args)
+	if err != nil {
+		return err
+	}
+
+	switch arg := args[0].(type) {
+	case *String:
+		return arg
+	case *Integer, *BigInteger:
+		if base == 0 {
+			base = 10
+		}
+		return rt.Allocator().NewString(toBig(arg).Text(base))
+	default:
+		if len(args) == 2 {
+			return newError("argument to `to_string` with a base must be INTEGER, got %s", arg.Type())
+		}
+		return rt.Allocator().NewString(arg.Inspect())
+	}
+}
+
+// baseArg returns the base in args[1], 10 if there is none. It is 2 to 36, or
+// 0, with which big.Int's SetString reads a prefix such as 0x.
+func baseArg(name string, args []Object) (int, *Error) {
+	if len(args) < 2 {
+		return 10, nil
+	}
+
+	base, err := intArg(name, args, 1)
+	if err != nil {
+		return 0, err
+	}
+	if base != 0 && (base < 2 || base > 36) {
+		return 0, newError("invalid base: %d", base)
+	}
+	return int(base), nil
+}
+
+// intArg returns the integer in args[i], which must fit in an int64.
+func intArg(name string, args []Object, i int) (int64, *Error) {
+	switch arg := args[i].(type) {
+	case *Integer:
+		return arg.Value, nil
+	case *BigInteger:
+		return 0, newError("argument to `%s` out of range: %s", name, arg.Inspect())
+	default:
+		return 0, newError("argument to `%s` must be INTEGER, got %s", name, arg.Type())
+	}
+}
+
+func stringArg(name string, args []Object, i int) (string, *Error) {
+	str, ok := args[i].(*String)
+	if !ok {
+		return "", newError("argument to `%s` must be STRING, got %s", name, args[i].Type())
+	}
+	return str.Value, nil
+}
+
+func textArg(name string, args []Object, i int) (string, *Error) {
+	text, ok := toText(args[i])
+	if !ok {
+		return "", newError("argument to `%s` must be STRING or CHAR, got %s", name, args[i].Type())
+	}
+	return text, nil
+}
+
+func toText(obj Object) (string, bool) {
+	switch obj := obj.(type) {
+	case *String:
+		return obj.Value, true
+	case *Char:
+		return string(obj.Value), true
+	default:
+		return "", false
+	}
+}
+
+func newStringArray(rt Runtime, strs []string) Object {
+	elements := make([]Object, len(strs))
+	for i, str := range strs {
+		elements[i] = rt.Allocator().NewString(str)
+		if isError(elements[i]) {
+			return elements[i]
+		}
+	}
+	return rt.Allocator().NewArray(elements)
+}
+
+func nativeBoolToBooleanObject(value bool) *Boolean {
+	if value {
+		return TRUE
+	}
+	return FALSE
+}
@@ -1,10 +1,13 @@
 package parser
 
 import (
-	"fmt"
+	"errors"
+	"math/big"
 	"monkey-language/ast"
+	"monkey-language/diagnostic"
 	"monkey-language/lexer"
 	"monkey-language/token"
+	"sort"
 	"strconv"
 )
 
@@ -19,7 +22,15 @@ type Parser struct {
 	curToken  token.Token
 	peekToken token.Token
 
-	errors []string
+	errors []*diagnostic.Diagnostic
+	// lexErrors counts the lexer's errors already copied into errors.
+	lexErrors int
+	// panicking is set once an error is reported and cleared when the parser
+	// synchronizes, so a single mistake yields a single diagnostic.
+	panicking bool
+	// loopDepth counts the loops enclosing the current statement within the
+	// current function, to reject break and continue outside of one.
+	loopDepth int
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -28,44 +39,70 @@ type Parser struct {
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // = or +=
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
-	SUM         // +
-	PRODUCT     // *
+	SUM         // + or |
+	PRODUCT     // * or &
 	PREFIX      // -x or !x
 	CALL        // myFunction(x)
 	INDEX       // array[index]
 )
 
+// Bitwise operators bind like they do in Go, so a & 1 == 0 needs no
+// parentheses.
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSING:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.PERCENT_ASSIGN:  ASSIGN,
+	token.OR:              LOGICAL_OR,
+	token.AND:             LOGICAL_AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.BIT_OR:          SUM,
+	token.BIT_XOR:         SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.BIT_AND:         PRODUCT,
+	token.SHL:             PRODUCT,
+	token.SHR:             PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
+	token.DOT:             INDEX,
 }
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, errors: []*diagnostic.Diagnostic{}}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.BIT_NOT, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -76,8 +113,25 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.BIT_AND, p.parseInfixExpression)
+	p.registerInfix(token.BIT_OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_XOR, p.parseInfixExpression)
+	p.registerInfix(token.SHL, p.parseInfixExpression)
+	p.registerInfix(token.SHR, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.ASSING, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PERCENT_ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
 	// Read two tokens, so curToken and peekToken are both set
 
 	p.nextToken()
@@ -87,7 +141,6 @@ func New(l *lexer.Lexer) *Parser {
 }
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.curToken}
-	hash.Paris = make(map[ast.Expression]ast.Expression)
 
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
@@ -100,7 +153,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 
-		hash.Paris[key] = value
+		hash.Pairs = append(hash.Pairs, ast.HashLiteralPair{Key: key, Value: value})
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -127,6 +180,17 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.curToken, Object: left}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	exp.Member = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return exp
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 
@@ -193,6 +257,29 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseAssignExpression parses an assignment, which is right associative so
+// a = b = 1 assigns 1 to both.
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Target:   target,
+	}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		p.addError(diagnostic.New(diagnostic.InvalidAssignment, p.curToken,
+			"cannot assign to %s", target.String()))
+		return nil
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGN - 1)
+
+	return expression
+}
+
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
 	p.prefixParseFns[tokenType] = fn
 }
@@ -204,10 +291,29 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	// The lexer reports its own errors for ILLEGAL tokens, possibly several
+	// for one token. They are separate mistakes so they are kept even in
+	// panic mode.
+	lexErrors := p.l.Errors()
+	p.errors = append(p.errors, lexErrors[p.lexErrors:]...)
+	p.lexErrors = len(lexErrors)
+}
+
+// Errors returns the diagnostics reported while parsing, in source order.
+func (p *Parser) Errors() []*diagnostic.Diagnostic {
+	sorted := append([]*diagnostic.Diagnostic(nil), p.errors...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Span.Start.Offset < sorted[j].Span.Start.Offset
+	})
+	return sorted
 }
 
-func (p *Parser) Errors() []string {
-	return p.errors
+// parseIllegal enters panic mode without a diagnostic of its own, the lexer
+// already reported the ILLEGAL token.
+func (p *Parser) parseIllegal() ast.Expression {
+	p.panicking = true
+	return nil
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
@@ -250,7 +356,11 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
+	// break and continue cannot reach a loop outside of the function.
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	lit.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 
 	return lit
 }
@@ -263,14 +373,18 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		return identifiers
 	}
 
-	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 
 	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	identifiers = append(identifiers, ident)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
-		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 		identifiers = append(identifiers, ident)
@@ -316,6 +430,63 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	expression.Block = p.parseBlockStatement()
+
+	if !p.peekTokenIs(token.CATCH) && !p.peekTokenIs(token.FINALLY) {
+		// Step off the '}', which synchronize would take for the end of
+		// an enclosing block.
+		p.nextToken()
+		d := diagnostic.New(diagnostic.UnexpectedToken, p.curToken,
+			"expected catch or finally after try block, got %s instead", p.curToken.Type)
+		d.Expected = []token.TokenType{token.CATCH, token.FINALLY}
+		p.addError(d)
+		return nil
+	}
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		expression.CatchParam = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	return expression
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
@@ -324,10 +495,19 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
+		if stmt == nil {
+			p.synchronize()
+			continue
+		}
+
 		block.Statements = append(block.Statements, stmt)
 		p.nextToken()
 	}
 
+	if !p.curTokenIs(token.RBRACE) {
+		p.unexpectedTokenError(token.RBRACE, p.curToken)
+	}
+
 	return block
 }
 
@@ -347,9 +527,38 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if err == nil {
+		lit.Value = value
+		return lit
+	}
+
+	if errors.Is(err, strconv.ErrRange) {
+		if value, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			lit.Big = value
+			return lit
+		}
+	}
+
+	p.addError(diagnostic.New(diagnostic.InvalidNumber, p.curToken,
+		"could not parse %q as integer", p.curToken.Literal))
+	return nil
+}
+
+func (p *Parser) addError(d *diagnostic.Diagnostic) {
+	if p.panicking {
+		return
+	}
+	p.errors = append(p.errors, d)
+	p.panicking = true
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(diagnostic.New(diagnostic.InvalidNumber, p.curToken,
+			"could not parse %q as float", p.curToken.Literal))
 		return nil
 	}
 
@@ -359,8 +568,29 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.unexpectedTokenError(t, p.peekToken)
+}
+
+func (p *Parser) unexpectedTokenError(t token.TokenType, got token.Token) {
+	d := diagnostic.New(diagnostic.UnexpectedToken, got,
+		"expected next token to be %s, got %s instead", t, got.Type)
+	d.Expected = []token.TokenType{t}
+	if isPunctuation(t) {
+		d.Fix = "insert \"" + string(t) + "\""
+	}
+	p.addError(d)
+}
+
+// isPunctuation reports whether the type of t is spelled the same as its
+// literal, in which case we can suggest inserting it.
+func isPunctuation(t token.TokenType) bool {
+	switch t {
+	case token.SEMICOLON, token.COMMA, token.COLON, token.ASSING,
+		token.LPAREN, token.RPAREN, token.LBRACE, token.RBRACE,
+		token.LBRACKET, token.RBRACKET:
+		return true
+	}
+	return false
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -369,31 +599,130 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 	for !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
-		program.Statements = append(program.Statements, stmt)
+		if stmt == nil {
+			p.synchronize()
+			// A '}' left over at the top level has no block to close.
+			if p.curTokenIs(token.RBRACE) {
+				p.nextToken()
+			}
+			continue
+		}
 
+		program.Statements = append(program.Statements, stmt)
 		p.nextToken()
 	}
 
 	return program
 }
 
+// parseStatement returns nil if an error was reported while parsing the
+// statement, leaving the parser in panic mode until it synchronizes.
 func (p *Parser) parseStatement() ast.Statement {
+	var stmt ast.Statement
+
 	switch p.curToken.Type {
-	case token.LET:
-		return p.parseLetStatement()
+	case token.LET, token.CONST:
+		if s := p.parseLetStatement(); s != nil {
+			stmt = s
+		}
 	case token.RETURN:
-		return p.parseReturnStatement()
+		if s := p.parseReturnStatement(); s != nil {
+			stmt = s
+		}
+	case token.THROW:
+		if s := p.parseThrowStatement(); s != nil {
+			stmt = s
+		}
+	case token.WHILE:
+		if s := p.parseWhileStatement(); s != nil {
+			stmt = s
+		}
+	case token.FOR:
+		if s := p.parseForStatement(); s != nil {
+			stmt = s
+		}
+	case token.BREAK, token.CONTINUE:
+		stmt = p.parseLoopControlStatement()
 	default:
-		return p.parseExpressionStatement()
+		if s := p.parseExpressionStatement(); s != nil {
+			stmt = s
+		}
+	}
+
+	if p.panicking {
+		return nil
+	}
+
+	return stmt
+}
+
+// statementStarts are the tokens that begin a statement, where the parser
+// can safely resume after an error.
+var statementStarts = map[token.TokenType]bool{
+	token.LET:    true,
+	token.CONST:  true,
+	token.RETURN: true,
+	token.IF:     true,
+	token.WHILE:  true,
+	token.FOR:    true,
+	token.THROW:  true,
+	token.TRY:    true,
+}
+
+// synchronize leaves panic mode by skipping tokens until the start of the
+// next statement: the token after a ';' or after a block that was opened
+// while skipping, a statement keyword, or the '}' closing the enclosing
+// block, which is left for the caller to consume.
+func (p *Parser) synchronize() {
+	p.panicking = false
+	depth := 0
+
+	for !p.curTokenIs(token.EOF) {
+		switch p.curToken.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth == 0 {
+				return
+			}
+			depth--
+			if depth == 0 && !p.continuesExpression() {
+				p.nextToken()
+				return
+			}
+		case token.SEMICOLON:
+			if depth == 0 {
+				p.nextToken()
+				return
+			}
+		}
+
+		if depth == 0 && (p.peekTokenIs(token.RBRACE) || statementStarts[p.peekToken.Type]) {
+			p.nextToken()
+			return
+		}
+
+		p.nextToken()
 	}
 }
 
+// continuesExpression reports whether the peek token can only follow a block
+// that is nested in a larger expression, such as a function literal passed
+// as an argument, so the statement isn't over yet.
+func (p *Parser) continuesExpression() bool {
+	switch p.peekToken.Type {
+	case token.RPAREN, token.RBRACKET, token.COMMA, token.SEMICOLON:
+		return true
+	}
+	return false
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
 	stmt.Expression = p.parseExpression(LOWEST)
 
-	if p.peekTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) && !p.panicking {
 		p.nextToken()
 	}
 
@@ -401,8 +730,8 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(diagnostic.New(diagnostic.ExpectedExpression, p.curToken,
+		"no prefix parse function for %s found", t))
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
@@ -413,7 +742,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	}
 	leftExp := prefix()
 
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+	for !p.panicking && !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -434,13 +763,117 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	if p.peekTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) && !p.panicking {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) && !p.panicking {
 		p.nextToken()
 	}
 
 	return stmt
 }
 
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) && !p.panicking {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) && !p.panicking {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlockStatement()
+}
+
+// parseLoopControlStatement parses break or continue.
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	tok := p.curToken
+
+	if p.loopDepth == 0 {
+		p.addError(diagnostic.New(diagnostic.OutsideLoop, tok, "%s outside of a loop", tok.Literal))
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
@@ -458,7 +891,11 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
-	if p.peekTokenIs(token.SEMICOLON) {
+	if fl, ok := stmt.Value.(*ast.FunctionalLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) && !p.panicking {
 		p.nextToken()
 	}
 
@@ -3,7 +3,9 @@ package parser
 import (
 	"fmt"
 	"monkey-language/ast"
+	"monkey-language/diagnostic"
 	"monkey-language/lexer"
+	"monkey-language/token"
 	"strconv"
 	"testing"
 )
@@ -44,6 +46,31 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestConstStatement(t *testing.T) {
+	l := lexer.New("const x = 5;")
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement, got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.LetStatement, got=%T", program.Statements[0])
+	}
+
+	if !stmt.IsConst() {
+		t.Errorf("stmt.IsConst() is false")
+	}
+
+	if stmt.String() != "const x = 5;" {
+		t.Errorf("wrong String(), got=%q", stmt.String())
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	input := `
 	return 5;
@@ -105,6 +132,58 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"-a.b * c.d(1)",
+			"((-(a.b)) * (c.d)(1))",
+		},
+		{
+			"a.b.c(1)[0].d",
+			"((((a.b).c)(1)[0]).d)",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a <= b && c >= d || !e",
+			"(((a <= b) && (c >= d)) || (!e))",
+		},
+		{
+			"a == b && c != d",
+			"((a == b) && (c != d))",
+		},
+		{
+			"a + b % c",
+			"(a + (b % c))",
+		},
+		{
+			"x & 1 == 0",
+			"((x & 1) == 0)",
+		},
+		{
+			"a | b ^ c & d",
+			"((a | b) ^ (c & d))",
+		},
+		{
+			"1 << 2 + 3 >> 1",
+			"((1 << 2) + (3 >> 1))",
+		},
+		{
+			"~a & b",
+			"((~a) & b)",
+		},
+		{
+			"x = y = 1 + 2",
+			"(x = (y = (1 + 2)))",
+		},
+		{
+			"a[i + 1] += b || c",
+			"((a[(i + 1)]) += (b || c))",
+		},
+		{
+			"h[\"k\"] = fn(x) { x }",
+			"((h[k]) = fn(x) x)",
+		},
 	}
 
 	for _, tst := range tests {
@@ -224,6 +303,55 @@ func TestIntegerLiteralExpressions(t *testing.T) {
 	}
 }
 
+func TestBigIntegerLiteralExpressions(t *testing.T) {
+	input := "9223372036854775808;"
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.IntegerLiteral, got=%T", stmt.Expression)
+	}
+
+	if literal.Big == nil || literal.Big.String() != "9223372036854775808" {
+		t.Errorf("literal.Big not %s, got=%v", "9223372036854775808", literal.Big)
+	}
+}
+
+func TestFloatLiteralExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{".5;", 0.5},
+		{"1e-9;", 1e-9},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral, got=%T", stmt.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g, got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input        string
@@ -448,6 +576,129 @@ func TestIfExpression(t *testing.T) {
 	}
 }
 
+func TestLoopStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x < 10) { x }", "while(x < 10) x"},
+		{"while (true) { break; continue; };", "whiletrue break;continue;"},
+		{"for (x in [1, 2]) { puts(x) }", "for (x in [1, 2]) puts(x)"},
+		{"for (k in h) { while (k) { break } }", "for (k in h) whilek break;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement, got=%d", len(program.Statements))
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong, expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"throw bad;", "throw bad;"},
+		{"try { f() } catch (e) { e }", "try f() catch (e) e"},
+		{"try { f() } finally { g() }", "try f() finally g()"},
+		{"let x = try { f() } catch (e) { 0 } finally { g() };", "let x = try f() catch (e) 0 finally g();"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement, got=%d", len(program.Statements))
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong, expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestTryWithoutCatchOrFinally(t *testing.T) {
+	p := New(lexer.New("try { f() }; 1; fn() { try { g() } }"))
+	p.ParseProgram()
+
+	expected := []string{
+		"1:12: expected catch or finally after try block, got ; instead",
+		"1:36: expected catch or finally after try block, got } instead",
+	}
+
+	if len(p.Errors()) != len(expected) {
+		t.Fatalf("wrong number of errors, expected=%d, got=%d: %v", len(expected), len(p.Errors()), p.Errors())
+	}
+
+	for i, d := range p.Errors() {
+		if d.Error() != expected[i] {
+			t.Errorf("errors[%d] wrong, expected=%q, got=%q", i, expected[i], d.Error())
+		}
+	}
+}
+
+func TestInvalidAssignmentTarget(t *testing.T) {
+	tests := []string{
+		"1 = 2;",
+		"f() = 1;",
+		"a + b = c;",
+		"a.b = c;",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) != 1 {
+			t.Errorf("wrong number of errors for %q, expected=1, got=%d: %v", input, len(p.Errors()), p.Errors())
+			continue
+		}
+
+		if p.Errors()[0].Code != diagnostic.InvalidAssignment {
+			t.Errorf("wrong code for %q, expected=%s, got=%s", input, diagnostic.InvalidAssignment, p.Errors()[0].Code)
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []string{
+		"break;",
+		"if (true) { continue; }",
+		"while (true) { fn() { break; } }",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) != 1 {
+			t.Errorf("wrong number of errors for %q, expected=1, got=%d: %v", input, len(p.Errors()), p.Errors())
+			continue
+		}
+
+		if p.Errors()[0].Code != diagnostic.OutsideLoop {
+			t.Errorf("wrong code for %q, expected=%s, got=%s", input, diagnostic.OutsideLoop, p.Errors()[0].Code)
+		}
+	}
+}
+
 func TestIfElseExpression(t *testing.T) {
 	input := `if (x < y) { x } else { y }`
 
@@ -692,6 +943,35 @@ func TestParsingExpressions(t *testing.T) {
 	}
 }
 
+func TestMemberExpressionParsing(t *testing.T) {
+	input := "myHash.field"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	memberExp, ok := stmt.Expression.(*ast.MemberExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.MemberExpression, got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, memberExp.Object, "myHash") {
+		return
+	}
+
+	if !testIdentifier(t, memberExp.Member, "field") {
+		return
+	}
+
+	p = New(lexer.New("a.if"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 || p.Errors()[0].Error() != "1:3: expected next token to be IDENT, got IF instead" {
+		t.Errorf("wrong errors for a.if, got=%v", p.Errors())
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 
@@ -707,8 +987,8 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 		t.Fatalf("exp is not ast.HashLiteral, got=%T", stmt.Expression)
 	}
 
-	if len(hash.Paris) != 3 {
-		t.Errorf("hast.Paris has wrong length, got=%d", len(hash.Paris))
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length, got=%d", len(hash.Pairs))
 	}
 
 	expected := map[string]int64{
@@ -717,7 +997,9 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 		"three": 3,
 	}
 
-	for key, value := range hash.Paris {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
+
 		literal, ok := key.(*ast.StringLiteral)
 		if !ok {
 			t.Errorf("key is not ast.StringLiteral, got=%T", key)
@@ -727,6 +1009,10 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 
 		testIntegerLiteral(t, value, expectedValue)
 	}
+
+	if hash.String() != "{one:1, two:2, three:3}" {
+		t.Errorf("pairs not in source order, got=%q", hash.String())
+	}
 }
 
 func TestParsingHashLiteralsIntegerKeys(t *testing.T) {
@@ -744,8 +1030,8 @@ func TestParsingHashLiteralsIntegerKeys(t *testing.T) {
 		t.Fatalf("exp is not ast.HashLiteral, got=%T", stmt.Expression)
 	}
 
-	if len(hash.Paris) != 3 {
-		t.Errorf("hast.Paris has wrong length, got=%d", len(hash.Paris))
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length, got=%d", len(hash.Pairs))
 	}
 
 	expected := map[int64]int64{
@@ -754,7 +1040,9 @@ func TestParsingHashLiteralsIntegerKeys(t *testing.T) {
 		3: 3,
 	}
 
-	for key, value := range hash.Paris {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
+
 		literal, ok := key.(*ast.IntegerLiteral)
 		if !ok {
 			t.Errorf("key is not ast.IntegerLiteral, got=%T", key)
@@ -781,8 +1069,8 @@ func TestParsingHashLiteralsBooleanKeys(t *testing.T) {
 		t.Fatalf("exp is not ast.HashLiteral, got=%T", stmt.Expression)
 	}
 
-	if len(hash.Paris) != 2 {
-		t.Errorf("hast.Paris has wrong length, got=%d", len(hash.Paris))
+	if len(hash.Pairs) != 2 {
+		t.Errorf("hash.Pairs has wrong length, got=%d", len(hash.Pairs))
 	}
 
 	expected := map[bool]int64{
@@ -790,7 +1078,9 @@ func TestParsingHashLiteralsBooleanKeys(t *testing.T) {
 		false: 2,
 	}
 
-	for key, value := range hash.Paris {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
+
 		literal, ok := key.(*ast.Boolean)
 		if !ok {
 			t.Errorf("key is not ast.BooleanLiteral, got=%T", key)
@@ -817,8 +1107,8 @@ func TestParsingEmptyHashLiteral(t *testing.T) {
 		t.Fatalf("exp is not ast.HashLiteral, got=%T", stmt.Expression)
 	}
 
-	if len(hash.Paris) != 0 {
-		t.Errorf("hast.Paris has wrong length, got=%d", len(hash.Paris))
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length, got=%d", len(hash.Pairs))
 	}
 }
 
@@ -837,8 +1127,8 @@ func TestParsingHashLiteralsWithExpression(t *testing.T) {
 		t.Fatalf("exp is not ast.HashLiteral, got=%T", stmt.Expression)
 	}
 
-	if len(hash.Paris) != 3 {
-		t.Errorf("hast.Paris has wrong length, got=%d", len(hash.Paris))
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length, got=%d", len(hash.Pairs))
 	}
 
 	expected := map[string]func(ast.Expression){
@@ -853,7 +1143,9 @@ func TestParsingHashLiteralsWithExpression(t *testing.T) {
 		},
 	}
 
-	for key, value := range hash.Paris {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
+
 		literal, ok := key.(*ast.StringLiteral)
 		if !ok {
 			t.Errorf("key is not ast.StringLiteral, got=%T", key)
@@ -870,3 +1162,193 @@ func TestParsingHashLiteralsWithExpression(t *testing.T) {
 	}
 
 }
+
+func TestParserDiagnostics(t *testing.T) {
+	input := "let x 5;"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	d := errors[0]
+	if d.Code != diagnostic.UnexpectedToken {
+		t.Errorf("d.Code not %s, got=%s", diagnostic.UnexpectedToken, d.Code)
+	}
+
+	if d.Severity != diagnostic.Error {
+		t.Errorf("d.Severity not error, got=%s", d.Severity)
+	}
+
+	if len(d.Expected) != 1 || d.Expected[0] != token.ASSING {
+		t.Errorf("d.Expected not [%s], got=%v", token.ASSING, d.Expected)
+	}
+
+	if d.Actual != token.INT {
+		t.Errorf("d.Actual not %s, got=%s", token.INT, d.Actual)
+	}
+
+	if d.Span.Start.Line != 1 || d.Span.Start.Column != 7 || d.Span.End.Column != 8 {
+		t.Errorf("wrong span, got=%s-%s", d.Span.Start, d.Span.End)
+	}
+
+	if d.Fix != `insert "="` {
+		t.Errorf("d.Fix wrong, got=%q", d.Fix)
+	}
+
+	if d.Error() != "1:7: expected next token to be =, got INT instead" {
+		t.Errorf("d.Error() wrong, got=%q", d.Error())
+	}
+}
+
+func TestParserErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     int
+		expectedStatements []string
+	}{
+		{
+			`let x 5;
+			let y = 10;
+			let = 3;
+			let z = y * ;
+			z;`,
+			3,
+			[]string{"let y = 10;", "z"},
+		},
+		{
+			`let add = fn(a, b) { let = 1; a + b };
+			add(1, 2);`,
+			1,
+			[]string{"let add = fn(a, b) (a + b);", "add(1, 2)"},
+		},
+		{
+			`if (x { let a = 1; }
+			let b = 2;`,
+			1,
+			[]string{"let b = 2;"},
+		},
+		{
+			`let a = [1 +, fn() { x }];
+			let b = 2;`,
+			1,
+			[]string{"let b = 2;"},
+		},
+		{
+			`let f = fn() { 1 + };
+			f();`,
+			1,
+			[]string{"let f = fn() ;", "f()"},
+		},
+		{
+			`let a = 1; }
+			a;`,
+			1,
+			[]string{"let a = 1;", "a"},
+		},
+		{
+			`let f = fn(x) { x`,
+			1,
+			[]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		if len(p.Errors()) != tt.expectedErrors {
+			t.Errorf("wrong number of errors for %q, expected=%d, got=%d: %v", tt.input, tt.expectedErrors, len(p.Errors()), p.Errors())
+		}
+
+		if len(program.Statements) != len(tt.expectedStatements) {
+			t.Errorf("wrong number of statements for %q, expected=%d, got=%d", tt.input, len(tt.expectedStatements), len(program.Statements))
+			continue
+		}
+
+		for i, stmt := range program.Statements {
+			if stmt == nil {
+				t.Fatalf("program.Statements[%d] is nil", i)
+			}
+
+			if stmt.String() != tt.expectedStatements[i] {
+				t.Errorf("program.Statements[%d] wrong, expected=%q, got=%q", i, tt.expectedStatements[i], stmt.String())
+			}
+		}
+	}
+}
+
+func TestLexerErrorsAreReportedOnce(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedCode diagnostic.Code
+	}{
+		{"let x = 1 # 2;", diagnostic.IllegalCharacter},
+		{"let x = 1; /* unterminated", diagnostic.UnterminatedComment},
+		{`let s = "unterminated;`, diagnostic.UnterminatedString},
+		{`let s = "bad \q escape";`, diagnostic.InvalidEscape},
+		{"let x = 1.5e;", diagnostic.InvalidExponent},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) != 1 {
+			t.Errorf("wrong number of errors for %q, expected=1, got=%d: %v", tt.input, len(p.Errors()), p.Errors())
+			continue
+		}
+
+		if p.Errors()[0].Code != tt.expectedCode {
+			t.Errorf("wrong code for %q, expected=%s, got=%s", tt.input, tt.expectedCode, p.Errors()[0].Code)
+		}
+	}
+}
+
+func TestAllLexerErrorsOfATokenAreReported(t *testing.T) {
+	input := `let s = "\q \z";`
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 2 {
+		t.Fatalf("wrong number of errors, expected=2, got=%d: %v", len(errors), errors)
+	}
+
+	for i, col := range []int{10, 13} {
+		if errors[i].Code != diagnostic.InvalidEscape {
+			t.Errorf("errors[%d] has wrong code, expected=%s, got=%s", i, diagnostic.InvalidEscape, errors[i].Code)
+		}
+		if errors[i].Span.Start.Column != col {
+			t.Errorf("errors[%d] at wrong column, expected=%d, got=%d", i, col, errors[i].Span.Start.Column)
+		}
+	}
+}
+
+func TestErrorsReturnsACopy(t *testing.T) {
+	input := `let x = 1 # 2; let = 5;`
+
+	l := lexer.New(input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 2 {
+		t.Fatalf("wrong number of errors, expected=2, got=%d: %v", len(errors), errors)
+	}
+	first := errors[0]
+	errors[0], errors[1] = errors[1], nil
+
+	again := p.Errors()
+	if len(again) != 2 || again[0] != first || again[1] == nil {
+		t.Errorf("changing the result of Errors changed the parser's errors: %v", again)
+	}
+}
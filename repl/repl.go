@@ -4,18 +4,34 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"monkey-language/compiler"
+	"monkey-language/diagnostic"
 	"monkey-language/evaluator"
 	"monkey-language/lexer"
 	"monkey-language/object"
 	"monkey-language/parser"
+	"monkey-language/vm"
 )
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
+const (
+	EngineEval = "eval"
+	EngineVM   = "vm"
+)
+
+// Start runs the REPL, evaluating every line with the given engine.
+func Start(in io.Reader, out io.Writer, engine string) {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
 
+	constants := []object.Object{}
+	globals := make([]object.Object, vm.GlobalsSize)
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
 	for {
 		fmt.Fprintf(out, PROMPT)
 		scanned := scanner.Scan()
@@ -30,7 +46,37 @@ func Start(in io.Reader, out io.Writer) {
 		program := p.ParseProgram()
 
 		if len(p.Errors()) != 0 {
-			printParseErrors(out, p.Errors())
+			diagnostic.RenderAll(out, line, p.Errors())
+			continue
+		}
+
+		if engine == EngineVM {
+			comp := compiler.NewWithState(symbolTable, constants)
+			err := comp.Compile(program)
+			if err != nil {
+				fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
+				continue
+			}
+
+			code := comp.Bytecode()
+			constants = code.Constants
+
+			machine := vm.NewWithGlobalsState(code, globals)
+			err = machine.Run()
+			if objErr, ok := err.(*object.Error); ok {
+				io.WriteString(out, objErr.Inspect())
+				io.WriteString(out, "\n")
+				io.WriteString(out, objErr.StackTrace())
+				continue
+			} else if err != nil {
+				fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", err)
+				continue
+			}
+
+			if result := machine.LastPoppedStackElem(); result != nil {
+				io.WriteString(out, result.Inspect())
+				io.WriteString(out, "\n")
+			}
 			continue
 		}
 
@@ -39,11 +85,8 @@ func Start(in io.Reader, out io.Writer) {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
 		}
-	}
-}
-
-func printParseErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+		if errObj, ok := evaluated.(*object.Error); ok {
+			io.WriteString(out, errObj.StackTrace())
+		}
 	}
 }
@@ -0,0 +1,1011 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"monkey-language/code"
+	"monkey-language/compiler"
+	"monkey-language/object"
+)
+
+// StackSize is the initial size of the stack, which grows as calls nest.
+const StackSize = 2048
+const GlobalsSize = 65536
+
+// DefaultMaxDepth is the call depth at which the VM stops with a
+// STACK_OVERFLOW error unless WithMaxDepth sets another one. It is the
+// evaluator's default, so that both engines run the same programs.
+const DefaultMaxDepth = 10000
+
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
+
+var operators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+	code.OpBitXor:       "^",
+	code.OpShiftLeft:    "<<",
+	code.OpShiftRight:   ">>",
+	code.OpGreaterThan:  ">",
+	code.OpLessThan:     "<",
+	code.OpGreaterEqual: ">=",
+	code.OpLessEqual:    "<=",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+}
+
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // Always points to the next value. Top of stack is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	handlers []handler // the tries being run, innermost last
+
+	overflow object.Overflow
+	maxDepth int
+
+	lastPopped object.Object
+}
+
+type Option func(*VM)
+
+// WithMaxDepth sets how deeply function calls may nest, by default
+// DefaultMaxDepth.
+func WithMaxDepth(n int) Option {
+	return func(vm *VM) {
+		vm.maxDepth = n
+	}
+}
+
+// WithOverflow sets what integer arithmetic does when a result does not fit
+// in an int64, by default object.OverflowPromote.
+func WithOverflow(o object.Overflow) Option {
+	return func(vm *VM) {
+		vm.overflow = o
+	}
+}
+
+// handler is a try being run. An error raised in it unwinds the frames and
+// the stack to where the try started and continues at catchPos.
+type handler struct {
+	framesIndex int
+	sp          int
+	catchPos    int
+}
+
+func New(bytecode *compiler.Bytecode, opts ...Option) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, 1, 64)
+	frames[0] = mainFrame
+
+	vm := &VM{
+		constants:   bytecode.Constants,
+		globals:     make([]object.Object, GlobalsSize),
+		globalNames: bytecode.GlobalNames,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		frames:      frames,
+		framesIndex: 1,
+
+		maxDepth: DefaultMaxDepth,
+	}
+	for _, opt := range opts {
+		opt(vm)
+	}
+	return vm
+}
+
+// NewWithGlobalsState returns a VM sharing globals with earlier runs, as the
+// REPL does between lines.
+func NewWithGlobalsState(bytecode *compiler.Bytecode, s []object.Object, opts ...Option) *VM {
+	vm := New(bytecode, opts...)
+	vm.globals = s
+	return vm
+}
+
+// LastPoppedStackElem returns the value of the last expression statement,
+// the result of running the program.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.lastPopped
+}
+
+// Run executes the bytecode. Errors raised by the program and not caught by
+// it are returned as *object.Error, with the position of the failing
+// expression and the stack of calls it was raised in attached.
+func (vm *VM) Run() error {
+	return vm.run(0)
+}
+
+// run executes instructions until the frames above the first base ones
+// return. Errors are only caught by the tries run in those frames.
+func (vm *VM) run(base int) error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.framesIndex > base && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		frame := vm.currentFrame()
+		frame.ip++
+
+		ip = frame.ip
+		ins = frame.Instructions()
+		op = code.Opcode(ins[ip])
+
+		done, err := vm.execute(op, ins, ip)
+		if err != nil {
+			err = vm.annotate(err, frame, ip)
+			if vm.catch(err, base) {
+				continue
+			}
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// execute runs a single instruction. It reports done when the program
+// returned from its top level.
+func (vm *VM) execute(op code.Opcode, ins code.Instructions, ip int) (bool, error) {
+	switch op {
+	case code.OpConstant:
+		constIndex := code.ReadUint16(ins[ip+1:])
+		vm.currentFrame().ip += 2
+
+		return false, vm.push(vm.constants[constIndex])
+
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+		code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+		code.OpGreaterEqual, code.OpLessEqual:
+		return false, vm.executeBinaryOperation(op)
+
+	case code.OpTrue:
+		return false, vm.push(True)
+
+	case code.OpFalse:
+		return false, vm.push(False)
+
+	case code.OpNull:
+		return false, vm.push(Null)
+
+	case code.OpBang:
+		return false, vm.executeBangOperator()
+
+	case code.OpMinus:
+		return false, vm.executeMinusOperator()
+
+	case code.OpBitNot:
+		operand := vm.pop()
+		if operand.Type() != object.INTEGER_OBJ {
+			return false, newError("unknown operator: ~%s", operand.Type())
+		}
+		return false, vm.pushResult(object.IntegerPrefix(vm, "~", operand))
+
+	case code.OpPop:
+		vm.lastPopped = vm.pop()
+
+	case code.OpJump:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().ip = pos - 1
+
+	case code.OpJumpNotTruthy:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().ip += 2
+
+		condition := vm.pop()
+		if !isTruthy(condition) {
+			vm.currentFrame().ip = pos - 1
+		}
+
+	case code.OpIter:
+		iterable := vm.pop()
+		values, ok := object.Iterate(iterable)
+		if !ok {
+			return false, newError("cannot iterate over %s", iterable.Type())
+		}
+		return false, vm.push(&iterator{values: values})
+
+	case code.OpIterNext:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().ip += 2
+
+		it := vm.pop().(*iterator)
+		if it.next == len(it.values) {
+			vm.currentFrame().ip = pos - 1
+			return false, nil
+		}
+
+		it.next++
+		return false, vm.push(it.values[it.next-1])
+
+	case code.OpTry:
+		catchPos := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().ip += 2
+
+		vm.handlers = append(vm.handlers, handler{framesIndex: vm.framesIndex, sp: vm.sp, catchPos: catchPos})
+
+	case code.OpEndTry:
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	case code.OpCatch:
+		err := vm.pop().(*object.Error)
+		return false, vm.push(err.Caught())
+
+	case code.OpThrow:
+		// The compiler rethrows an error it saved while running a finally
+		// block as it is.
+		value := vm.pop()
+		if err, ok := value.(*object.Error); ok {
+			return false, err
+		}
+		return false, object.Throw(value)
+
+	case code.OpSetGlobal:
+		globalIndex := code.ReadUint16(ins[ip+1:])
+		vm.currentFrame().ip += 2
+
+		vm.globals[globalIndex] = vm.pop()
+
+	case code.OpGetGlobal:
+		globalIndex := code.ReadUint16(ins[ip+1:])
+		vm.currentFrame().ip += 2
+
+		global := vm.globals[globalIndex]
+		if global == nil {
+			return false, newError("identifier not found: %s", vm.globalName(int(globalIndex)))
+		}
+
+		return false, vm.push(global)
+
+	case code.OpSetLocal:
+		localIndex := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().ip += 1
+
+		frame := vm.currentFrame()
+		slot := &vm.stack[frame.basePointer+int(localIndex)]
+		if c, ok := (*slot).(*cell); ok {
+			c.value = vm.pop()
+		} else {
+			*slot = vm.pop()
+		}
+
+	case code.OpGetLocal:
+		localIndex := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().ip += 1
+
+		frame := vm.currentFrame()
+		return false, vm.push(deref(vm.stack[frame.basePointer+int(localIndex)]))
+
+	case code.OpGetBuiltin:
+		builtinIndex := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().ip += 1
+
+		definition := object.Builtins[builtinIndex]
+		return false, vm.push(definition.Builtin)
+
+	case code.OpGetFree:
+		freeIndex := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().ip += 1
+
+		currentClosure := vm.currentFrame().cl
+		return false, vm.push(deref(currentClosure.Free[freeIndex]))
+
+	case code.OpSetFree:
+		freeIndex := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().ip += 1
+
+		currentClosure := vm.currentFrame().cl
+		currentClosure.Free[freeIndex].(*cell).value = vm.pop()
+
+	case code.OpCaptureLocal:
+		localIndex := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().ip += 1
+
+		frame := vm.currentFrame()
+		slot := &vm.stack[frame.basePointer+int(localIndex)]
+		if _, ok := (*slot).(*cell); !ok {
+			*slot = &cell{value: *slot}
+		}
+		return false, vm.push(*slot)
+
+	case code.OpCaptureFree:
+		freeIndex := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().ip += 1
+
+		currentClosure := vm.currentFrame().cl
+		return false, vm.push(currentClosure.Free[freeIndex])
+
+	case code.OpArray:
+		numElements := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().ip += 2
+
+		array := vm.buildArray(vm.sp-numElements, vm.sp)
+		vm.sp = vm.sp - numElements
+
+		return false, vm.push(array)
+
+	case code.OpHash:
+		numElements := int(code.ReadUint16(ins[ip+1:]))
+		vm.currentFrame().ip += 2
+
+		hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+		if err != nil {
+			return false, err
+		}
+		vm.sp = vm.sp - numElements
+
+		return false, vm.push(hash)
+
+	case code.OpHashKey:
+		if _, ok := vm.stack[vm.sp-1].(object.Hashable); !ok {
+			return false, newError("unusable as hash key: %s", vm.stack[vm.sp-1].Type())
+		}
+
+	case code.OpIndex:
+		index := vm.pop()
+		left := vm.pop()
+
+		return false, vm.executeIndexExpression(left, index)
+
+	case code.OpMember:
+		nameIndex := code.ReadUint16(ins[ip+1:])
+		vm.currentFrame().ip += 2
+
+		name := vm.constants[nameIndex].(*object.String).Value
+		return false, vm.pushResult(object.Member(vm.pop(), name))
+
+	case code.OpSetIndex:
+		value := vm.pop()
+		index := vm.pop()
+		left := vm.pop()
+
+		return false, vm.executeSetIndex(left, index, value)
+
+	case code.OpDup2:
+		left, index := vm.stack[vm.sp-2], vm.stack[vm.sp-1]
+		if err := vm.push(left); err != nil {
+			return false, err
+		}
+		return false, vm.push(index)
+
+	case code.OpAssignGlobal:
+		globalIndex := code.ReadUint16(ins[ip+1:])
+		vm.currentFrame().ip += 2
+
+		if vm.globals[globalIndex] == nil {
+			return false, newError("cannot assign to undefined identifier: %s", vm.globalName(int(globalIndex)))
+		}
+
+		vm.globals[globalIndex] = vm.stack[vm.sp-1]
+
+	case code.OpCall:
+		numArgs := code.ReadUint8(ins[ip+1:])
+		vm.currentFrame().ip += 1
+
+		return false, vm.executeCall(int(numArgs))
+
+	case code.OpReturnValue:
+		returnValue := vm.pop()
+
+		if vm.framesIndex == 1 {
+			vm.lastPopped = returnValue
+			return true, nil
+		}
+
+		frame := vm.popFrame()
+		vm.sp = frame.basePointer - 1
+		vm.dropHandlers()
+
+		return false, vm.push(returnValue)
+
+	case code.OpReturn:
+		frame := vm.popFrame()
+		vm.sp = frame.basePointer - 1
+		vm.dropHandlers()
+
+		return false, vm.push(Null)
+
+	case code.OpClosure:
+		constIndex := code.ReadUint16(ins[ip+1:])
+		numFree := code.ReadUint8(ins[ip+3:])
+		vm.currentFrame().ip += 3
+
+		return false, vm.pushClosure(int(constIndex), int(numFree))
+
+	default:
+		return false, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return false, nil
+}
+
+// annotate attaches the source position of the instruction at ip in frame
+// to err, if it is an *object.Error without one.
+func (vm *VM) annotate(err error, frame *Frame, ip int) error {
+	objErr, ok := err.(*object.Error)
+	if !ok || objErr.Pos.IsValid() {
+		return err
+	}
+
+	if pos, ok := frame.cl.Fn.SourceMap[ip]; ok {
+		objErr.Pos = pos
+	}
+
+	return objErr
+}
+
+// catch hands err to the innermost try being run above the first base
+// frames, if there is one and err is not fatal, and reports whether it did.
+// Otherwise it attaches the stack of calls err was raised in above them, as
+// err leaves them.
+func (vm *VM) catch(err error, base int) bool {
+	objErr, ok := err.(*object.Error)
+	if !ok {
+		return false
+	}
+
+	if len(vm.handlers) == 0 || vm.handlers[len(vm.handlers)-1].framesIndex <= base || objErr.Kind.Fatal() {
+		vm.unwind(objErr, base)
+		return false
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	vm.unwind(objErr, h.framesIndex)
+	vm.framesIndex = h.framesIndex
+	vm.sp = h.sp
+	vm.currentFrame().ip = h.catchPos - 1
+
+	vm.push(objErr)
+	return true
+}
+
+// unwind adds the calls of the frames above the first framesIndex ones to
+// the stack of err, innermost first.
+func (vm *VM) unwind(err *object.Error, framesIndex int) {
+	for i := vm.framesIndex - 1; i >= framesIndex && i > 0; i-- {
+		caller := vm.frames[i-1]
+		err.Stack = append(err.Stack, object.Frame{
+			Function: vm.frames[i].cl.Fn.Name,
+			Pos:      caller.cl.Fn.SourceMap[caller.ip-1],
+		})
+	}
+}
+
+// dropHandlers drops the handlers of tries left by returning from the frame
+// they were run in.
+func (vm *VM) dropHandlers() {
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].framesIndex > vm.framesIndex {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+}
+
+func (vm *VM) globalName(index int) string {
+	if index < len(vm.globalNames) {
+		return vm.globalNames[index]
+	}
+	return fmt.Sprintf("global %d", index)
+}
+
+// iterator is the state of a for loop, kept in a variable slot that the
+// program cannot name.
+type iterator struct {
+	values []object.Object
+	next   int
+}
+
+func (it *iterator) Type() object.ObjectType { return "ITERATOR" }
+func (it *iterator) Inspect() string         { return "iterator" }
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= len(vm.stack) {
+		vm.growStack(vm.sp + 1)
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+	case op == code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(object.Equal(left, right)))
+	case op == code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(!object.Equal(left, right)))
+	case leftType == object.CHAR_OBJ && rightType == object.CHAR_OBJ:
+		return vm.executeBinaryCharOperation(op, left, right)
+	case isText(left) && isText(right):
+		return vm.executeBinaryStringOperation(op, left, right)
+	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+		return vm.executeBinaryIntegerOperation(op, left, right)
+	case isNumber(left) && isNumber(right):
+		return vm.executeBinaryFloatOperation(op, left, right)
+	default:
+		return newError("unknown operator: %s %s %s", leftType, operators[op], rightType)
+	}
+}
+
+// executeBinaryIntegerOperation handles integers, which may be
+// *object.Integer or *object.BigInteger.
+func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
+	switch op {
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(object.CompareIntegers(left, right) > 0))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(object.CompareIntegers(left, right) < 0))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(object.CompareIntegers(left, right) >= 0))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(object.CompareIntegers(left, right) <= 0))
+	default:
+		return vm.pushResult(object.IntegerArithmetic(vm, operators[op], left, right))
+	}
+}
+
+// pushResult pushes obj, or returns it if it is an error.
+func (vm *VM) pushResult(obj object.Object) error {
+	if err, ok := obj.(*object.Error); ok {
+		return err
+	}
+	return vm.push(obj)
+}
+
+// executeBinaryFloatOperation handles floats and mixed operands, promoting
+// an integer operand to a float.
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Float{Value: leftValue + rightValue})
+	case code.OpSub:
+		return vm.push(&object.Float{Value: leftValue - rightValue})
+	case code.OpMul:
+		return vm.push(&object.Float{Value: leftValue * rightValue})
+	case code.OpDiv:
+		return vm.push(&object.Float{Value: leftValue / rightValue})
+	case code.OpMod:
+		return vm.push(&object.Float{Value: math.Mod(leftValue, rightValue)})
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInteger:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	default:
+		return obj.(*object.Float).Value
+	}
+}
+
+func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
+	if op != code.OpAdd {
+		return newError("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+
+	return vm.push(&object.String{Value: text(left) + text(right)})
+}
+
+func (vm *VM) executeBinaryCharOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.Char).Value
+	rightValue := right.(*object.Char).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.String{Value: string(leftValue) + string(rightValue)})
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+// isText reports whether obj is a string or a char, which concatenate with
+// each other.
+func isText(obj object.Object) bool {
+	return obj.Type() == object.STRING_OBJ || obj.Type() == object.CHAR_OBJ
+}
+
+func text(obj object.Object) string {
+	if ch, ok := obj.(*object.Char); ok {
+		return string(ch.Value)
+	}
+	return obj.(*object.String).Value
+}
+
+func (vm *VM) executeBangOperator() error {
+	operand := vm.pop()
+
+	switch operand {
+	case True:
+		return vm.push(False)
+	case False:
+		return vm.push(True)
+	case Null:
+		return vm.push(True)
+	default:
+		return vm.push(False)
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+
+	switch operand := operand.(type) {
+	case *object.Integer, *object.BigInteger:
+		return vm.pushResult(object.IntegerPrefix(vm, "-", operand))
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
+		return newError("unknown operator: -%s", operand.Type())
+	}
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hash := object.NewHash()
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		pair := object.HashPair{Key: key, Value: value}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, newError("unusable as hash key: %s", key.Type())
+		}
+
+		hash.Set(hashKey.HashKey(), pair)
+	}
+
+	return hash, nil
+}
+
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		i, ok := index.(*object.Integer)
+		if !ok || i.Value < 0 || i.Value >= int64(len(elements)) {
+			return newError("index out of range: %s", index.Inspect())
+		}
+		elements[i.Value] = value
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.(*object.Hash).Set(key.HashKey(), object.HashPair{Key: index, Value: value})
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+
+	return vm.push(value)
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arrayObject := array.(*object.Array)
+	i, ok := index.(*object.Integer)
+	max := int64(len(arrayObject.Elements) - 1)
+
+	// A big integer is out of the range of any array.
+	if !ok || i.Value < 0 || i.Value > max {
+		return vm.push(Null)
+	}
+
+	return vm.push(arrayObject.Elements[i.Value])
+}
+
+// executeStringIndex indexes a string by chars, not bytes.
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	stringObject := str.(*object.String)
+	integer, ok := index.(*object.Integer)
+	if !ok || integer.Value < 0 {
+		return vm.push(Null)
+	}
+
+	i := integer.Value
+
+	for _, ch := range stringObject.Value {
+		if i == 0 {
+			return vm.push(&object.Char{Value: ch})
+		}
+		i--
+	}
+
+	return vm.push(Null)
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Get(key.HashKey())
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(pair.Value)
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return newError("not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return newError("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+
+	// The main frame is not a call.
+	if vm.framesIndex-1 >= vm.maxDepth {
+		return &object.Error{
+			Kind:    object.STACK_OVERFLOW_ERR,
+			Message: fmt.Sprintf("stack overflow: maximum call depth of %d exceeded", vm.maxDepth),
+		}
+	}
+
+	basePointer := vm.sp - numArgs
+	if basePointer+cl.Fn.NumLocals >= len(vm.stack) {
+		vm.growStack(basePointer + cl.Fn.NumLocals + 1)
+	}
+
+	frame := NewFrame(cl, basePointer)
+	vm.pushFrame(frame)
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	// Clear the locals, which may hold a cell left by an earlier call.
+	for i := basePointer + numArgs; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Fn(vm, args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+
+	if result != nil {
+		return vm.push(result)
+	}
+
+	return vm.push(Null)
+}
+
+// Call runs fn with args on top of the frames being run, for a builtin
+// calling back into the program.
+func (vm *VM) Call(fn object.Object, args ...object.Object) object.Object {
+	cl, ok := fn.(*object.Closure)
+	if !ok {
+		builtin, ok := fn.(*object.Builtin)
+		if !ok {
+			return newError("not a function: %s", fn.Type())
+		}
+		if result := builtin.Fn(vm, args...); result != nil {
+			return result
+		}
+		return Null
+	}
+
+	sp, base := vm.sp, vm.framesIndex
+	err := vm.push(cl)
+	for _, arg := range args {
+		if err == nil {
+			err = vm.push(arg)
+		}
+	}
+	if err == nil {
+		err = vm.callClosure(cl, len(args))
+	}
+	if err == nil {
+		err = vm.run(base)
+	}
+
+	if err != nil {
+		vm.framesIndex = base
+		vm.sp = sp
+		vm.dropHandlers()
+		if objErr, ok := err.(*object.Error); ok {
+			return objErr
+		}
+		return newError("%s", err)
+	}
+
+	return vm.pop()
+}
+
+// Allocator returns nil, as the VM does not limit memory.
+func (vm *VM) Allocator() *object.Allocator { return nil }
+func (vm *VM) Overflow() object.Overflow    { return vm.overflow }
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+// cell holds a local variable captured by a closure, in its stack slot and
+// the Free of the closures, so that they all share it.
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType { return "CELL" }
+func (c *cell) Inspect() string         { return c.value.Inspect() }
+
+// deref returns the value of a variable, which may be held in a cell.
+func deref(obj object.Object) object.Object {
+	if c, ok := obj.(*cell); ok {
+		return c.value
+	}
+	return obj
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// growStack makes the stack hold at least n values, doubling it so that
+// deep recursion grows it a few times only.
+func (vm *VM) growStack(n int) {
+	size := 2 * len(vm.stack)
+	if size < n {
+		size = n
+	}
+	stack := make([]object.Object, size)
+	copy(stack, vm.stack)
+	vm.stack = stack
+}
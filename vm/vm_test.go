@@ -0,0 +1,482 @@
+package vm
+
+import (
+	"monkey-language/ast"
+	"monkey-language/compiler"
+	"monkey-language/evaluator"
+	"monkey-language/lexer"
+	"monkey-language/object"
+	"monkey-language/parser"
+	"testing"
+)
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+// run compiles and runs input, returning the result or the runtime error.
+func run(t *testing.T, input string) object.Object {
+	t.Helper()
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if objErr, ok := err.(*object.Error); ok {
+		return objErr
+	} else if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	return vm.LastPoppedStackElem()
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) {
+	t.Helper()
+
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"4 / 2", 2},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, run(t, tt.input), tt.expected)
+	}
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			`let fibonacci = fn(x) {
+				if (x == 0) { return 0; }
+				if (x == 1) { return 1; }
+				fibonacci(x - 1) + fibonacci(x - 2);
+			};
+			fibonacci(15);`,
+			610,
+		},
+		{
+			`let wrapper = fn() {
+				let countDown = fn(x) {
+					if (x == 0) { return 0; } else { countDown(x - 1); }
+				};
+				countDown(1);
+			};
+			wrapper();`,
+			0,
+		},
+		{
+			`let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+			let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+			if (isEven(10)) { 1 } else { 0 }`,
+			1,
+		},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, run(t, tt.input), tt.expected)
+	}
+}
+
+func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn() { 1; }(1);`, "wrong number of arguments: want=0, got=1"},
+		{`fn(a) { a; }();`, "wrong number of arguments: want=1, got=0"},
+		{`fn(a, b) { a + b; }(1);`, "wrong number of arguments: want=2, got=1"},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := run(t, tt.input).(*object.Error)
+		if !ok {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		if errObj.Message != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"let min = -9223372036854775807 - 1; -min", "integer overflow: -(-9223372036854775808)"},
+		{"1 << 63", "integer overflow: 1 << 63"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err := New(comp.Bytecode(), WithOverflow(object.OverflowError)).Run()
+		errObj, ok := err.(*object.Error)
+		if !ok {
+			t.Errorf("expected VM error for %q, got=%v", tt.input, err)
+			continue
+		}
+
+		if errObj.Kind != object.OVERFLOW_ERR || errObj.Message != tt.expected {
+			t.Errorf("wrong VM error for %q: want=%q, got=%s %q", tt.input, tt.expected, errObj.Kind, errObj.Message)
+		}
+	}
+}
+
+// TestParityWithEvaluator runs every program through both engines, which
+// must agree on the result, including error messages and positions.
+func TestParityWithEvaluator(t *testing.T) {
+	tests := []string{
+		"5",
+		"-5",
+		"5 + 5 + 5 + 5 - 10",
+		"(5 + 10 * 2 + 15 / 3) * 2 + -10",
+		"3.14",
+		"-.5",
+		"1 + 0.5",
+		"7 / 2.0",
+		"2.5 * 2",
+		"1e21",
+		"1.5 < 2",
+		"1 == 1.0",
+		"0.1 + 0.2",
+		"-true + 1.5",
+		`{1.5: "a"}[1.5]`,
+		`[{1: "a"}[1.0], {1.0: "a"}[1], {1 << 70: "b"}[1180591620717411303424.0], has({2: 1}, 2.0), {1.5: 1}[1], {1: "a", 1.0: "b"}]`,
+		"7 % 3",
+		"7.5 % 2",
+		"6 & 3 | 8 ^ 1",
+		"~5",
+		"1 << 4 >> 1",
+		"1 << -1",
+		"~1.5",
+		"2 <= 2",
+		"2 >= 3",
+		"1.5 <= 2",
+		`"a"[0] <= "b"[0]`,
+		`"a" <= "b"`,
+		"true && false",
+		"1 && 2",
+		"false || 0",
+		"if (false) { 1 } || false",
+		"false && missing",
+		"true || missing",
+		"true && missing",
+		"let f = fn(x) { x > 0 && x < 10 }; [f(5), f(50)]",
+		"let i = 0; while (i < 5) { let i = i + 1; }; i",
+		"let i = 0; while (true) { let i = i + 1; if (i == 3) { break; } }; i",
+		"let n = 0; let i = 0; while (i < 10) { let i = i + 1; if (i % 2 == 0) { continue; } let n = n + i; }; n",
+		"let sum = 0; for (x in [1, 2, 3]) { let sum = sum + x; }; sum",
+		`let s = ""; for (c in "héllo") { if (c == "l"[0]) { continue; } let s = s + c; }; s`,
+		`let s = ""; for (k in {"b": 1, "a": 2}) { let s = s + k; }; s`,
+		"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } }; f()",
+		"let f = fn() { while (false) {} }; f()",
+		"let f = fn() { let n = 0; for (x in [1, 2]) { for (y in [10, 20]) { if (y == 20) { break; } let n = n + x * y; } }; n }; f()",
+		"let f = fn(x) { let x = x + 1; x }; f(1)",
+		"for (x in 5) {}",
+		"while (missing) {}",
+		"let i = 0; while (i < 1000) { let i = i + 1; }; i",
+		"let x = 1; x = 2; x",
+		"let x = 1; let y = 1; x = y = 5; x + y",
+		"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x %= 4; x",
+		"let x = 1; let f = fn() { x = 5 }; f(); x",
+		"let x = 1; let f = fn(x) { x = 5 }; f(0); x",
+		"let f = fn() { let i = 0; let n = 0; while (i < 5) { i += 1; n += i; }; n }; f()",
+		"let a = [1, 2, 3]; a[1] = 20; a",
+		"let a = [1, 2, 3]; a[2] *= 10; a[2]",
+		`let h = {"a": 1}; h["b"] = 2; h["a"] += 10; h["a"] + h["b"]`,
+		"let a = [[1], [2]]; a[1][0] = 5; a[1][0]",
+		"let f = fn() { g = 1 }; let g = 0; f(); g",
+		"const x = 5; x * 2",
+		`{"b": 1, "a": 2, 3: 3, true: 4}`,
+		`["abc" == "abc", "abc" != "abd", "a" == "a"[0], "a" + "b"[0] == "ab"]`,
+		"[[1, [2, 3]] == [1, [2, 3]], [1, 2] == [2, 1], [1] != [1, 2], 1 == 1.0, [][0] == [1][1], true == 1]",
+		`[{"a": 1, "b": [2]} == {"b": [2], "a": 1}, {"a": 1} == {"a": 2}]`,
+		"let f = fn() {}; [f == f, fn() {} == fn() {}, len == len]",
+		"let a = [1]; let b = [1]; a[0] = a; b[0] = b; a == b",
+		`let a = [1]; [is(a, a), is([1], [1]), is({}, {}), is("ab", "a" + "b"), is(1, 1)]`,
+		"if ([1] == [1]) { 1 } else { 2 }",
+		`is(1)`,
+		`{"b": 1, "a": 2, "b": 3}`,
+		`let h = {"z": 1}; h["y"] = 2; h["z"] = 3; h`,
+		`let log = []; let f = fn(x) { log = push(log, x); x }; {f("c"): f(1), f("a"): f(2)}; log`,
+		`let ks = []; for (k in {"c": 1, "a": 2, "b": 3}) { ks = push(ks, k) }; ks`,
+		"map([1, 2, 3], fn(x) { x * 2 })",
+		`[map("ab", fn(c) { c + "!" }), map({"a": 1, "b": 2}, fn(k) { k })]`,
+		"map([1, 2], len)",
+		"filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })",
+		"[reduce([1, 2, 3], fn(acc, x) { acc + x }), reduce([1, 2], fn(acc, x) { push(acc, x) }, [])]",
+		"reduce([], fn(acc, x) { acc + x })",
+		`[sort([3, 1.5, 2, 1 << 70, -1]), sort(["b", "a"]), sort([3, 1, 2], fn(a, b) { a > b })]`,
+		`sort([[2, "a"], [1, "b"], [2, "c"], [1, "d"]], fn(a, b) { a[0] < b[0] })`,
+		`sort([1, "a"])`,
+		"sort([2, 1], fn(a, b) { a + true })",
+		`[zip([1, 2, 3], "ab"), zip([1], [])]`,
+		"[any([1, 2], fn(x) { x > 1 }), all([1, 2], fn(x) { x > 1 }), find([1, 2], fn(x) { x > 1 }), find([], fn(x) { true })]",
+		"[range(4), range(2, 5), range(5, 0, -2), range(3, 1)]",
+		"range(0, 1, 0)",
+		`[reverse([1, 2, 3]), reverse("héllo")]`,
+		"let n = 0; map([1, 2, 3], fn(x) { n += x }); n",
+		`try { map([1, 2], fn(x) { if (x == 2) { throw "two" } x }) } catch (e) { e }`,
+		"map([1], fn(x) { filter([1, 2], fn(y) { y > x }) })",
+		"let f = fn(x) { map([x], fn(y) { if (y > 3) { y } else { f(y + 1)[0] } }) }; f(0)",
+		"let f = fn(x) { x + true };\nlet g = fn() { map([1], f) };\ntry { g() } catch (e) { e[\"stack\"] }",
+		"let f = fn(x) { try { x + true } catch (e) { 7 } }; let g = fn() { map([1], f) }; try { g() } catch (e) { 0 }",
+		"let f = fn(x) { x + true }; let g = fn() { map([1], f) }; g()",
+		`[split("a,b,,c", ","), split("  a  b "), join(["a", "b"], ", "), trim("  a "), upper("héllo"), lower("ÉA")]`,
+		`[contains("hello", "ell"), contains([1, [2]], [2]), index_of("héllo", "l"), index_of([1, 2], 3)]`,
+		`[replace("aaa", "a", "b", 2), starts_with("hello", "he"), ends_with("hello", "he"), repeat("ab", 3), substr("héllo", 1, 3)]`,
+		`format("%s has %d items costing %.2f: %v", "cart", 3, 1.5, [1, true])`,
+		`format("%5.1f%% %c%c %x %q", 2, 65, "é"[0], "hi", "a")`,
+		`format("%d", "x")`,
+		`format("%d", 1, 2)`,
+		`[to_int("ff", 16), to_int(-3.9), to_int("123456789012345678901234567890"), to_string(255, 2), to_string([1, "a"])]`,
+		`to_int("abc")`,
+		`join(map(split("a b c"), upper), "-")`,
+		`[keys({"b": 1, "a": 2, 3: 3}), values({"b": 1, "a": 2}), entries({"b": 1, "a": [2]})]`,
+		`[has({"a": 1}, "a"), has({"a": 1}, "b"), delete({"a": 1, "b": 2, "c": 3}, "b")]`,
+		`let h = {"a": 1}; let m = merge(h, {"b": 2, "a": 3}); delete(m, "b"); [h, m]`,
+		`has({}, [])`,
+		`let h = {"a": 1, [1]: 2}`,
+		`{"a": 1,
+		  fn() {}: 1 / 0}`,
+		`let k = "b"; {"a": 1, k: 2, 3: 4, true: 5}`,
+		"[3, 1, 2].sort().map(fn(x) { x * 10 }).filter(fn(x) { x > 10 }).push(1)",
+		`["a b c".split().map(upper).join("-"), "  Hi ".trim().lower().len(), 42.to_string(), 1.5.to_int()]`,
+		`let h = {"name": "monkey", "keys": 1, "f": fn(x) { x + 1 }}; [h.name, h.missing, h.keys(), h.f(1), h.len()]`,
+		"let push = [1].push; push(2)",
+		"[1].nope()",
+		"let f = fn(a) { a.x }; f(5)",
+		"[1].push(1, 2)",
+		"let a = 5; let f = fn() { let a = a + 1; a }; [f(), a]",
+		"let g = fn() { let b = b; b }; g()",
+		"let x = 1; let x = x + 1; x",
+		"let f = fn(x) { let x = x * 2; let x = x + 1; x }; f(5)",
+		"let x = 1; let f = fn() { let x = x + 1; let g = fn() { let x = x * 10; x }; [x, g()] }; [f(), x]",
+		"let a = [0]; a[0] = a; a",
+		`let h = {"a": 1}; h["self"] = h; let b = [h, h]; b`,
+		"let mk = fn() { let c = 0; fn() { c += 1; c } }; let inc = mk(); inc(); [inc(), mk()()]",
+		"let f = fn() { let n = 1; let get = fn() { n }; n = 5; let set = fn(v) { n = v }; set(7); [get(), n] }; f()",
+		"let f = fn(a) { let g = fn() { fn() { a *= 2 } }; g()(); g()(); a }; f(3)",
+		"let f = fn() { let x = 1; let g = fn() { let x = 10; x += 1; x }; [g(), x] }; f()",
+		"let f = fn() { f = 1 }; f(); f",
+		"let g = fn() { let f = fn() { f = 2 }; f(); f }; g()",
+		"let f = fn() { fn() { f += 3 } }; let h = f(); f = 1; h(); f",
+		"let g = fn() { let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5) }; g()",
+		"let f = 5; let g = fn() { let f = fn() { f }; [f() == f, f] }; g()[0]",
+		"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; let g = f; let f = 5; g(3)",
+		"let acc = fn() { let items = []; let add = fn(x) { items = push(items, x); len(items) }; map([1, 2, 3], add); items }; acc()",
+		"let f = fn(n) { let g = fn() { n }; if (n > 0) { [g(), f(n - 1)] } else { g() } }; f(2)",
+		"1 / 0",
+		"let x = 0; 5 % x",
+		"9223372036854775807 + 1",
+		"let f = fn(n) { if (n < 2) { 1 } else { n * f(n - 1) } }; f(30)",
+		"let f = fn(n) { if (n == 0) { 0 } else { n + f(n - 1) } }; f(3000)",
+		"let f = fn(n) { if (n == 0) { 0 } else { n + f(n - 1) } }; f(9999)",
+		"let f = fn(n) { if (n == 0) { 0 } else { n + f(n - 1) } }; f(10000)",
+		`let f = fn() { f() }; try { f() } catch (e) { [e["kind"], e["message"]] }`,
+		"let f = fn(n) { if (n == 0) { 0 } else { 1 + len(map([n], fn(x) { f(x - 1) })) } }; f(2000)",
+		"let x = 1 << 70; [x > 1, x <= 1, x == 1 << 70, -x < x, x / 3, x % 3, ~x, x >> 60, x + 0.5]",
+		"let x = 1 << 70; let h = {x: 1}; [h[1 << 70], h[0], [1][x], x & 255, x | 1, x ^ x]",
+		"let a = [1]; a[1 << 70] = 2",
+		"(1 << 70) / 0",
+		"9223372036854775808",
+		`[range(1 << 70), repeat("ab", 1 << 70), substr("abc", 1 << 64), to_int("1", 1 << 70)]`,
+		`repeat("ab", 1 << 70)`,
+		"[-9223372036854775808, -9223372036854775808 == -9223372036854775807 - 1, 99999999999999999999 - 1]",
+		"let h = {1 << 70: 1}; h[1180591620717411303424]",
+		"let min = -9223372036854775807 - 1; [-min, min / -1, min % -1]",
+		`try { 1 / 0 } catch (e) { e["kind"] }`,
+		`try { 1 + true } catch (e) { e["message"] }`,
+		`try { 1 + true } catch (e) { e["kind"] }`,
+		`try { 1 } catch (e) { 2 }`,
+		`try { } catch (e) { 2 }`,
+		`try { throw "bad" } catch (e) { e + "!" }`,
+		`try { throw {"message": "bad", "code": 7} } catch (e) { e["code"] }`,
+		`throw "uncaught"`,
+		`throw {"message": "bad"}`,
+		`throw 1 + true`,
+		`let f = fn(x) { if (x < 0) { throw "negative" } x }; try { f(-1) } catch (e) { e }`,
+		`let f = fn() { 1 + true }; let g = fn() { f() }; try { g() } catch (e) { e["stack"] }`,
+		`let f = fn() { 1 + true }; let g = fn() { f() }; g()`,
+		`let f = fn() { throw "x" }; let g = fn() { try { f() } catch (e) { throw e + "y" } }; g()`,
+		`let log = []; try { log = push(log, 1) } finally { log = push(log, 2) }; log`,
+		`let log = []; try { throw "x" } catch (e) { log = push(log, e) } finally { log = push(log, "f") }; log`,
+		`let log = []; try { try { throw "x" } finally { log = push(log, "f") } } catch (e) { log = push(log, e) }; log`,
+		`let log = []; try { 1 + true } finally { log = push(log, "f") }`,
+		`let log = []; let f = fn() { try { return 1 } finally { log = push(log, "f") } }; [f(), log]`,
+		`let f = fn() { try { return 1 } finally { return 2 } }; f()`,
+		`let f = fn() { try { throw "x" } finally { return 2 } }; f()`,
+		`let f = fn() { try { throw "x" } catch (e) { return e } finally { 3 } }; f()`,
+		`let f = fn() { try { 1 } finally { throw "in finally" } }; try { f() } catch (e) { e }`,
+		`let s = 0; for (i in [1, 2, 3, 4]) { try { if (i == 2) { continue } if (i == 4) { break } s += i } finally { s += 10 } }; s`,
+		`let s = 0; while (true) { try { throw "x" } catch (e) { break } }; s`,
+		"let i = 0; let s = 0; while (i < 5000) { i += 1; let q = [1, if (i > 0) { continue; }]; s += 1 }; [i, s]",
+		"let i = 0; let s = 0; while (i < 5000) { i += 1; let q = [1, if (i > 2) { break; }]; s += 1 }; [i, s]",
+		"let s = 0; for (x in [1, 2, 3]) { s += 10 * if (x == 2) { continue } else { x } }; s",
+		`let s = 0; for (x in [1, 2, 3]) { let h = {"a": 1, "b": len([2, x + if (x == 2) { break } else { 0 }])}; s += h["b"] + x }; s`,
+		"let s = 0; for (x in [1, 2, 3]) { let a = [0]; a[0] += if (x == 2) { continue } else { x }; s += a[0] }; s",
+		`let s = 0; for (x in [1, 2, 3]) { s += try { x } finally { if (x == 2) { continue } } }; s`,
+		"let f = fn() { let r = [1, 2 + if (true) { return 5 }]; 0 }; f()",
+		"let ff = fn() { let fs = []; for (x in [1, 2, 3]) { fs = push(fs, fn() { x }) }; [fs[0](), fs[2]()] }; ff()",
+		"let fs = []; for (x in [1, 2, 3]) { fs = push(fs, fn() { x }) }; [fs[0](), fs[2]()]",
+		"let ff = fn() { let fs = []; let i = 0; while (i < 3) { let y = i; fs = push(fs, fn() { y }); i += 1 }; fs[0]() }; ff()",
+		`let i = 0; while (i < 3) { try { i += 1; if (i == 2) { throw "two" } } catch (e) { i += 10 } }; i`,
+		`try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e }`,
+		`try { try { throw 1 } finally { try { throw 5 } catch (e) { e } } } catch (e) { e }`,
+		`let f = fn(n) { if (n == 0) { throw "bottom" } f(n - 1) }; try { f(5) } catch (e) { len(e) }`,
+		`let x = try { 5 } catch (e) { 0 } + 1; x`,
+		`let f = fn() { let a = 1; try { a + true } catch (e) { a + 1 } }; f()`,
+		"const x = 5; let f = fn() { const x = 1; x }; f() + x",
+		"let s = 0; for (i in [1, 2, 3]) { const d = i * 2; s += d }; s",
+		"let x = 1; const x = 2; x",
+		"let f = fn() { g = 1 }; f()",
+		"x = 1",
+		"x += 1",
+		"let a = [1]; a[1] = 2",
+		`let s = "abc"; s[0] = "x"`,
+		`let h = {}; h[fn() {}] = 1`,
+		`let x = "a"; x -= 1`,
+		`let a = [1]; a["x"] += 1`,
+		"true",
+		"1 < 2",
+		"1 > 2",
+		"1 == 1",
+		"1 != 1",
+		"(1 < 2) == true",
+		"true == false",
+		"!true",
+		"!5",
+		"!!5",
+		"if (true) { 10 }",
+		"if (false) { 10 }",
+		"if (1) { 10 }",
+		"if (1 > 2) { 10 } else { 20 }",
+		"return 10; 9;",
+		"9; return 2 * 5; 9;",
+		"if (10 > 1) { if (10 > 1) { return 10; } return 1; }",
+		"5 + true;",
+		"5 + true; 5;",
+		"-true",
+		"5; true + false; 5",
+		"if (10 > 1) { true + false; }",
+		"foobar",
+		"let a = 5; a;",
+		"let a = 5; let b = a; let c = a + b + 5; c;",
+		"let identity = fn(x) { x; }; identity(5);",
+		"let identity = fn(x) { return x; }; identity(5);",
+		"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));",
+		"let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(3);",
+		"let one = 1; let f = fn() { let two = 2; fn() { one + two } }; f()();",
+		"let f = fn(a) { a + true }; f(1);",
+		"fn(a) { a }(1, 2)",
+		"1(2)",
+		`"Hello" + " " + "World!"`,
+		`"a" - "b"`,
+		`"a" == "a"`,
+		`len("")`,
+		`len("four")`,
+		`len(1)`,
+		`len("one", "two")`,
+		`first([1, 2, 3])`,
+		`first([])`,
+		`last([1, 2, 3])`,
+		`rest([1, 2, 3])`,
+		`rest([])`,
+		`push([1], 2)`,
+		"[1, 2 * 2, 3 + 3]",
+		"[1, 2, 3][1 + 1];",
+		"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i];",
+		"[1, 2, 3][3]",
+		"[1, 2, 3][-1]",
+		`"abc"[1]`,
+		`"abc"[3]`,
+		`"héllo"[1]`,
+		`"日本語"[2]`,
+		`"héllo"[5]`,
+		`len("héllo")`,
+		`bytes("hé")`,
+		`chars("hé")`,
+		`chars("")`,
+		`"a"[0] == "abc"[0]`,
+		`"a"[0] < "b"[0]`,
+		`"a"[0] + "b"[0]`,
+		`"x" + "é"[0]`,
+		`"a"[0] - "b"[0]`,
+		`let größe = 3; größe * 2`,
+		`{"é"[0]: 1}["é"[0]]`,
+		`{"foo": 5}["foo"]`,
+		`{"foo": 5}["bar"]`,
+		`{5: 5}[5]`,
+		`{true: 5}[true]`,
+		`{}["foo"]`,
+		`{"name": "Monkey"}[fn(x) { x }];`,
+		`{fn(x) { x }: 1}`,
+		`1[0]`,
+		`let x = 1; let x = x + 1; x`,
+		`let f = fn() { g() }; let g = fn() { 7 }; f()`,
+		`let f = fn() { missing }; f()`,
+		`let map = fn(arr, f) {
+			let iter = fn(arr, acc) {
+				if (len(arr) == 0) { acc } else { iter(rest(arr), push(acc, f(first(arr)))) }
+			};
+			iter(arr, []);
+		};
+		map([1, 2, 3], fn(x) { x * 2 })`,
+	}
+
+	for _, input := range tests {
+		expected := evaluator.Eval(parse(input), object.NewEnvironment())
+		actual := run(t, input)
+
+		if expected == nil || actual == nil {
+			t.Errorf("no result for %q, eval=%v, vm=%v", input, expected, actual)
+			continue
+		}
+
+		if expected.Inspect() != actual.Inspect() {
+			t.Errorf("engines disagree on %q, eval=%q, vm=%q", input, expected.Inspect(), actual.Inspect())
+		}
+
+		expectedErr, ok1 := expected.(*object.Error)
+		actualErr, ok2 := actual.(*object.Error)
+		if ok1 && ok2 && expectedErr.StackTrace() != actualErr.StackTrace() {
+			t.Errorf("engines disagree on the stack of %q, eval=%q, vm=%q", input, expectedErr.StackTrace(), actualErr.StackTrace())
+		}
+	}
+}